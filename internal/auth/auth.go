@@ -0,0 +1,197 @@
+// Package auth authenticates HTTP API callers by static API keys or JWTs and
+// carries the scopes they were granted.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+// Scopes gating the HTTP API.
+const (
+	ScopeOrdersRead = "orders:read"
+	// ScopeOrdersReadPII lifts the masking of personal data.
+	ScopeOrdersReadPII = "orders:read:pii"
+	// ScopeOrdersReadAnalytics hides personal data entirely, for callers
+	// without ScopeOrdersReadPII.
+	ScopeOrdersReadAnalytics = "orders:read:analytics"
+	// ScopeMetrics lets a scraper read /metrics.
+	ScopeMetrics = "metrics:read"
+	// ScopeAdmin grants every scope.
+	ScopeAdmin = "admin"
+)
+
+// HeaderAPIKey carries a static API key; JWTs come as bearer tokens.
+const HeaderAPIKey = "X-API-Key"
+
+// Authentication methods, as reported in logs and metrics.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodNone   = "none"
+)
+
+var (
+	// ErrNoCredentials is returned for requests without an API key or token.
+	ErrNoCredentials = errors.New("no credentials")
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrInvalidToken  = errors.New("invalid token")
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Subject string
+	Method  string
+	Scopes  []string
+}
+
+// Has reports whether p was granted scope, directly or through ScopeAdmin.
+func (p Principal) Has(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the principal stored by NewContext.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
+
+// HashKey returns the hex SHA-256 of an API key. Only hashes are stored:
+// keys are random and long, so a fast hash is enough to keep a leaked key
+// list useless.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyStore finds API keys by their HashKey.
+type KeyStore interface {
+	LookupAPIKey(ctx context.Context, hash string) (Principal, error)
+}
+
+// FileKeys are API keys loaded from a file, keyed by hash.
+type FileKeys map[string]Principal
+
+type fileKey struct {
+	Name   string   `json:"name"`
+	SHA256 string   `json:"sha256"`
+	Scopes []string `json:"scopes"`
+}
+
+// LoadKeyFile reads API keys from a JSON file of the form
+// [{"name": "support-bot", "sha256": "<HashKey>", "scopes": ["orders:read"]}].
+func LoadKeyFile(path string) (FileKeys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []fileKey
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	keys := make(FileKeys, len(list))
+	for i, k := range list {
+		hash := strings.ToLower(k.SHA256)
+		if k.Name == "" || len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s: key %d needs a name and a hex sha256", path, i)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("%s: key %s: %w", path, k.Name, err)
+		}
+		keys[hash] = Principal{Subject: k.Name, Method: MethodAPIKey, Scopes: k.Scopes}
+	}
+	return keys, nil
+}
+
+func (k FileKeys) LookupAPIKey(ctx context.Context, hash string) (Principal, error) {
+	p, ok := k[hash]
+	if !ok {
+		return Principal{}, ErrInvalidAPIKey
+	}
+	return p, nil
+}
+
+// APIKeyRepository is the API key side of the repository.
+type APIKeyRepository interface {
+	LookupAPIKey(ctx context.Context, hash string) (repo.APIKey, error)
+}
+
+// DBKeys are API keys stored in the api_keys table.
+type DBKeys struct {
+	Repo APIKeyRepository
+}
+
+func (k DBKeys) LookupAPIKey(ctx context.Context, hash string) (Principal, error) {
+	key, err := k.Repo.LookupAPIKey(ctx, hash)
+	if errors.Is(err, repo.ErrAPIKeyNotFound) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: key.Name, Method: MethodAPIKey, Scopes: key.Scopes}, nil
+}
+
+// MultiKeys looks a key up in each store in turn.
+type MultiKeys []KeyStore
+
+func (m MultiKeys) LookupAPIKey(ctx context.Context, hash string) (Principal, error) {
+	for _, s := range m {
+		p, err := s.LookupAPIKey(ctx, hash)
+		if !errors.Is(err, ErrInvalidAPIKey) {
+			return p, err
+		}
+	}
+	return Principal{}, ErrInvalidAPIKey
+}
+
+// Authenticator checks the credentials of requests. Either source may be
+// nil, which rejects its credentials.
+type Authenticator struct {
+	Keys KeyStore
+	JWT  *JWTVerifier
+}
+
+// Authenticate returns the caller of r. Bad credentials yield an error
+// wrapping ErrNoCredentials, ErrInvalidAPIKey or ErrInvalidToken; any other
+// error means the key store failed.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, _ := strings.Cut(h, " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return Principal{Method: MethodJWT}, fmt.Errorf("%w: not a bearer token", ErrInvalidToken)
+		}
+		if a.JWT == nil {
+			return Principal{Method: MethodJWT}, fmt.Errorf("%w: tokens are not accepted", ErrInvalidToken)
+		}
+		return a.JWT.Verify(strings.TrimSpace(token))
+	}
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		if a.Keys == nil {
+			return Principal{Method: MethodAPIKey}, ErrInvalidAPIKey
+		}
+		p, err := a.Keys.LookupAPIKey(r.Context(), HashKey(key))
+		if err != nil {
+			return Principal{Method: MethodAPIKey}, err
+		}
+		return p, nil
+	}
+	return Principal{Method: MethodNone}, ErrNoCredentials
+}
@@ -0,0 +1,155 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/auth"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func request(headers ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/order/A", nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	return r
+}
+
+func TestAPIKeyFromFile(t *testing.T) {
+	path := writeFile(t, "keys.json", fmt.Sprintf(`[{"name":"support-bot","sha256":%q,"scopes":["orders:read"]}]`, auth.HashKey("s3cret")))
+	keys, err := auth.LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &auth.Authenticator{Keys: keys}
+
+	p, err := a.Authenticate(request(auth.HeaderAPIKey, "s3cret"))
+	if err != nil || p.Subject != "support-bot" || p.Method != auth.MethodAPIKey || !p.Has(auth.ScopeOrdersRead) || p.Has(auth.ScopeAdmin) {
+		t.Fatalf("unexpected principal %+v, %v", p, err)
+	}
+	if _, err := a.Authenticate(request(auth.HeaderAPIKey, "guess")); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Fatalf("expected ErrInvalidAPIKey, got %v", err)
+	}
+	if _, err := a.Authenticate(request()); !errors.Is(err, auth.ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials, got %v", err)
+	}
+	if _, err := a.Authenticate(request("Authorization", "Bearer x.y.z")); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken without a JWKS, got %v", err)
+	}
+}
+
+func TestLoadKeyFileRejectsPlainKeys(t *testing.T) {
+	path := writeFile(t, "keys.json", `[{"name":"bot","sha256":"s3cret","scopes":["orders:read"]}]`)
+	if _, err := auth.LoadKeyFile(path); err == nil {
+		t.Fatal("expected an error for a key that is not a sha256")
+	}
+}
+
+type failingKeys struct{}
+
+func (failingKeys) LookupAPIKey(ctx context.Context, hash string) (auth.Principal, error) {
+	return auth.Principal{}, errors.New("connection refused")
+}
+
+func TestMultiKeysStopsAtStoreErrors(t *testing.T) {
+	keys := auth.MultiKeys{auth.FileKeys{}, failingKeys{}}
+	_, err := keys.LookupAPIKey(context.Background(), auth.HashKey("k"))
+	if err == nil || errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Fatalf("expected the store error, got %v", err)
+	}
+}
+
+func newJWT(t *testing.T) (*auth.JWTVerifier, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","use":"sig","crv":"P-256","x":%q,"y":%q},{"kty":"oct","kid":"hmac","k":"c2VjcmV0"}]}`,
+		b64(key.X.FillBytes(make([]byte, 32))), b64(key.Y.FillBytes(make([]byte, 32))))
+	v, err := auth.NewJWTVerifier(auth.JWTConfig{JWKSFile: writeFile(t, "jwks.json", jwks), Issuer: "https://idp.example", Audience: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, key
+}
+
+func sign(t *testing.T, key any, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWT(t *testing.T) {
+	v, key := newJWT(t)
+	a := &auth.Authenticator{JWT: v}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "analyst", "iss": "https://idp.example", "aud": "orders",
+			"exp": time.Now().Add(time.Hour).Unix(), "scope": "orders:read orders:read:pii",
+		}
+	}
+
+	p, err := a.Authenticate(request("Authorization", "Bearer "+sign(t, key, jwt.SigningMethodES256, "k1", valid())))
+	if err != nil || p.Subject != "analyst" || p.Method != auth.MethodJWT || !slices.Equal(p.Scopes, []string{"orders:read", "orders:read:pii"}) {
+		t.Fatalf("unexpected principal %+v, %v", p, err)
+	}
+
+	scp := valid()
+	delete(scp, "scope")
+	scp["scp"] = []string{"admin"}
+	if p, err := v.Verify(sign(t, key, jwt.SigningMethodES256, "k1", scp)); err != nil || !p.Has(auth.ScopeOrdersRead) {
+		t.Fatalf("scp list: %+v, %v", p, err)
+	}
+
+	expired := valid()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	noExp := valid()
+	delete(noExp, "exp")
+	otherAud := valid()
+	otherAud["aud"] = "billing"
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	for name, token := range map[string]string{
+		"expired":        sign(t, key, jwt.SigningMethodES256, "k1", expired),
+		"no exp":         sign(t, key, jwt.SigningMethodES256, "k1", noExp),
+		"other audience": sign(t, key, jwt.SigningMethodES256, "k1", otherAud),
+		"unknown kid":    sign(t, key, jwt.SigningMethodES256, "k2", valid()),
+		"forged":         sign(t, otherKey, jwt.SigningMethodES256, "k1", valid()),
+		"hmac":           sign(t, []byte("secret"), jwt.SigningMethodHS256, "hmac", valid()),
+		"garbage":        "not-a-token",
+	} {
+		if _, err := v.Verify(token); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
@@ -3,19 +3,31 @@ package cache
 import (
 	"container/list"
 	"sync"
+	"time"
 )
 
 //go:generate moq -pkg mocks -out ../mocks/cache_mock.go . Store
 
-// Store describes cache operations used by the service.
+// Store describes cache operations used by the service. Get and Set work
+// with bare values; Set records them as modified now.
 type Store interface {
 	Get(id string) ([]byte, bool)
 	Set(id string, b []byte)
+	GetEntry(id string) (*Entry, bool)
+	SetEntry(id string, e *Entry)
+	Delete(id string)
+}
+
+// Observer is notified about lookups and evictions of a Cache.
+type Observer interface {
+	Hit()
+	Miss()
+	Evicted()
 }
 
 type entry struct {
 	key   string
-	value []byte
+	value *Entry
 }
 
 type Cache struct {
@@ -23,6 +35,7 @@ type Cache struct {
 	items map[string]*list.Element
 	order *list.List
 	limit int
+	obs   Observer
 }
 
 func New(limit int) *Cache {
@@ -36,34 +49,56 @@ func New(limit int) *Cache {
 	}
 }
 
+// SetObserver installs o to be notified about hits, misses and evictions.
+func (c *Cache) SetObserver(o Observer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.obs = o
+}
+
 func (c *Cache) Get(id string) ([]byte, bool) {
+	e, ok := c.GetEntry(id)
+	if !ok {
+		return nil, false
+	}
+	return e.Body, true
+}
+
+func (c *Cache) Set(id string, b []byte) {
+	c.SetEntry(id, NewEntry(b, time.Now()))
+}
+
+func (c *Cache) GetEntry(id string) (*Entry, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	elem, ok := c.items[id]
 	if !ok {
+		if c.obs != nil {
+			c.obs.Miss()
+		}
 		return nil, false
 	}
+	if c.obs != nil {
+		c.obs.Hit()
+	}
 	c.order.MoveToFront(elem)
 	ent := elem.Value.(*entry)
 	return ent.value, true
 }
 
-func (c *Cache) Set(id string, b []byte) {
+// SetEntry caches e under id. e must not be modified afterwards.
+func (c *Cache) SetEntry(id string, e *Entry) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if elem, ok := c.items[id]; ok {
 		c.order.MoveToFront(elem)
-		buf := make([]byte, len(b))
-		copy(buf, b)
-		elem.Value.(*entry).value = buf
+		elem.Value.(*entry).value = e
 		return
 	}
 
-	buf := make([]byte, len(b))
-	copy(buf, b)
-	elem := c.order.PushFront(&entry{key: id, value: buf})
+	elem := c.order.PushFront(&entry{key: id, value: e})
 	c.items[id] = elem
 
 	if len(c.items) > c.limit {
@@ -71,6 +106,16 @@ func (c *Cache) Set(id string, b []byte) {
 	}
 }
 
+func (c *Cache) Delete(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[id]; ok {
+		delete(c.items, id)
+		c.order.Remove(elem)
+	}
+}
+
 func (c *Cache) evict() {
 	tail := c.order.Back()
 	if tail == nil {
@@ -79,6 +124,9 @@ func (c *Cache) evict() {
 	ent := tail.Value.(*entry)
 	delete(c.items, ent.key)
 	c.order.Remove(tail)
+	if c.obs != nil {
+		c.obs.Evicted()
+	}
 }
 
 func (c *Cache) Len() int {
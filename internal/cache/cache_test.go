@@ -2,6 +2,7 @@ package cache_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/kosovrzn/wb-tech-l0/internal/cache"
 )
@@ -47,3 +48,53 @@ func TestCacheUpdateKeepsEntry(t *testing.T) {
 		t.Fatalf("expected y to be evicted")
 	}
 }
+
+func TestCacheDeleteRemovesEntry(t *testing.T) {
+	c := cache.New(2)
+
+	c.Set("x", []byte("1"))
+	c.Delete("x")
+	c.Delete("missing")
+
+	if _, ok := c.Get("x"); ok {
+		t.Fatalf("expected key x to be deleted")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("expected len 0 got %d", c.Len())
+	}
+}
+
+type countingObserver struct{ hits, misses, evictions int }
+
+func (o *countingObserver) Hit()     { o.hits++ }
+func (o *countingObserver) Miss()    { o.misses++ }
+func (o *countingObserver) Evicted() { o.evictions++ }
+
+func TestCacheReportsToObserver(t *testing.T) {
+	c := cache.New(1)
+	obs := &countingObserver{}
+	c.SetObserver(obs)
+
+	c.Set("a", []byte("1"))
+	c.Get("a")
+	c.Set("b", []byte("2")) // evicts a
+	c.Get("a")
+
+	if obs.hits != 1 || obs.misses != 1 || obs.evictions != 1 {
+		t.Fatalf("unexpected observer counts: %+v", *obs)
+	}
+}
+
+func TestEntryETagFollowsContent(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 999, time.UTC)
+	a := cache.NewEntry([]byte(`{"a":1}`), modified)
+	b := cache.NewEntry([]byte(`{"a":1}`), time.Now())
+	c := cache.NewEntry([]byte(`{"a":2}`), modified)
+
+	if a.ETag != b.ETag || a.ETag == c.ETag {
+		t.Fatalf("unexpected etags: %s %s %s", a.ETag, b.ETag, c.ETag)
+	}
+	if !a.LastModified.Equal(modified.Truncate(time.Second)) {
+		t.Fatalf("expected Last-Modified truncated to seconds, got %v", a.LastModified)
+	}
+}
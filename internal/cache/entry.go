@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Entry is a cached value with the validators of conditional requests and
+// the encoded forms and renditions of the value computed so far.
+type Entry struct {
+	Body []byte
+	// ETag is a strong validator: a quoted hash of Body.
+	ETag string
+	// LastModified is when the value was last written, truncated to seconds
+	// as in HTTP dates. Zero means unknown.
+	LastModified time.Time
+
+	mu         sync.Mutex
+	encoded    map[string][]byte
+	renditions map[string]*Entry
+}
+
+// NewEntry returns an entry of a copy of body, modified at modified.
+func NewEntry(body []byte, modified time.Time) *Entry {
+	buf := bytes.Clone(body)
+	sum := sha256.Sum256(buf)
+	e := &Entry{Body: buf, ETag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+	if !modified.IsZero() {
+		e.LastModified = modified.UTC().Truncate(time.Second)
+	}
+	return e
+}
+
+// Encoded returns Body in encoding, e.g. "gzip". It is computed by encode on
+// the first call and kept with the entry, so it is only computed once for as
+// long as the entry is cached.
+func (e *Entry) Encoded(encoding string, encode func([]byte) ([]byte, error)) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if b, ok := e.encoded[encoding]; ok {
+		return b, nil
+	}
+	b, err := encode(e.Body)
+	if err != nil {
+		return nil, err
+	}
+	if e.encoded == nil {
+		e.encoded = make(map[string][]byte, 2)
+	}
+	e.encoded[encoding] = b
+	return b, nil
+}
+
+// maxRenditions bounds the renditions kept with an entry, as a client picks
+// the fields of each.
+const maxRenditions = 16
+
+// Rendition returns the entry of Body transformed by render, such as the
+// order masked for a role, cached with e under key like the encoded forms.
+// It shares LastModified with e and goes away with it, so it never outlives
+// the value it was rendered from.
+func (e *Entry) Rendition(key string, render func([]byte) ([]byte, error)) (*Entry, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if r, ok := e.renditions[key]; ok {
+		return r, nil
+	}
+	body, err := render(e.Body)
+	if err != nil {
+		return nil, err
+	}
+	r := NewEntry(body, e.LastModified)
+	if e.renditions == nil {
+		e.renditions = make(map[string]*Entry, 2)
+	}
+	if len(e.renditions) >= maxRenditions {
+		for k := range e.renditions {
+			delete(e.renditions, k)
+			break
+		}
+	}
+	e.renditions[key] = r
+	return r, nil
+}
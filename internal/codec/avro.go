@@ -0,0 +1,263 @@
+package codec
+
+import (
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+)
+
+// OrderSchema is the Avro schema of an order snapshot, for producers to register.
+//
+//go:embed order.avsc
+var OrderSchema string
+
+// ErrRegistryUnavailable marks a schema lookup that failed because the
+// registry could not be reached, as opposed to an unknown or broken schema.
+// The message may decode once the registry is back.
+var ErrRegistryUnavailable = errors.New("schema registry unavailable")
+
+// SchemaRegistry resolves the writer schema of a Confluent-framed message.
+type SchemaRegistry interface {
+	Schema(ctx context.Context, id int) (avro.Schema, error)
+}
+
+// NewSchemaRegistry returns a registry stand-in for location: an http(s) URL
+// of a Confluent-compatible registry, or a directory (optionally as a file://
+// URL) holding one <id>.avsc file per schema.
+func NewSchemaRegistry(location string) (SchemaRegistry, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("schema registry %q: %w", location, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &httpRegistry{base: strings.TrimRight(location, "/"), client: &http.Client{Timeout: 5 * time.Second}}, nil
+	case "file":
+		return &fileRegistry{dir: u.Path}, nil
+	case "":
+		return &fileRegistry{dir: location}, nil
+	default:
+		return nil, fmt.Errorf("schema registry %q: unsupported scheme %q", location, u.Scheme)
+	}
+}
+
+type fileRegistry struct {
+	dir   string
+	cache sync.Map
+}
+
+func (r *fileRegistry) Schema(_ context.Context, id int) (avro.Schema, error) {
+	if s, ok := r.cache.Load(id); ok {
+		return s.(avro.Schema), nil
+	}
+	b, err := os.ReadFile(filepath.Join(r.dir, strconv.Itoa(id)+".avsc"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w: %w", id, ErrRegistryUnavailable, err)
+	}
+	s, err := avro.ParseBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	r.cache.Store(id, s)
+	return s, nil
+}
+
+// httpRegistry speaks the GET /schemas/ids/{id} subset of the Confluent API.
+type httpRegistry struct {
+	base   string
+	client *http.Client
+	cache  sync.Map
+}
+
+func (r *httpRegistry) Schema(ctx context.Context, id int) (avro.Schema, error) {
+	if s, ok := r.cache.Load(id); ok {
+		return s.(avro.Schema), nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", r.base, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w: %w", id, ErrRegistryUnavailable, err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusOK:
+	case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("schema %d: %w: registry returned %s", id, ErrRegistryUnavailable, res.Status)
+	default:
+		return nil, fmt.Errorf("schema %d: registry returned %s", id, res.Status)
+	}
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	s, err := avro.Parse(body.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	r.cache.Store(id, s)
+	return s, nil
+}
+
+// Avro decodes orders in the Confluent wire format: a zero magic byte, a
+// big-endian schema id and the Avro binary encoding of the record.
+type Avro struct {
+	schemas SchemaRegistry
+}
+
+func NewAvro(schemas SchemaRegistry) *Avro { return &Avro{schemas: schemas} }
+
+func (a *Avro) Decode(ctx context.Context, b []byte) (*domain.Order, error) {
+	if len(b) < 5 || b[0] != magicByte {
+		return nil, errors.New("avro order: not in confluent wire format")
+	}
+	id := int(binary.BigEndian.Uint32(b[1:5]))
+	schema, err := a.schemas.Schema(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("avro order: %w", err)
+	}
+	var rec avroOrder
+	if err := avro.Unmarshal(schema, b[5:], &rec); err != nil {
+		return nil, fmt.Errorf("avro order: %w", err)
+	}
+	return rec.order(), nil
+}
+
+type avroOrder struct {
+	OrderUID          string       `avro:"order_uid"`
+	TrackNumber       string       `avro:"track_number"`
+	Entry             string       `avro:"entry"`
+	Delivery          avroDelivery `avro:"delivery"`
+	Payment           avroPayment  `avro:"payment"`
+	Items             []avroItem   `avro:"items"`
+	Locale            string       `avro:"locale"`
+	InternalSignature string       `avro:"internal_signature"`
+	CustomerID        string       `avro:"customer_id"`
+	DeliveryService   string       `avro:"delivery_service"`
+	Shardkey          string       `avro:"shardkey"`
+	SmID              int64        `avro:"sm_id"`
+	DateCreated       time.Time    `avro:"date_created"`
+	OofShard          string       `avro:"oof_shard"`
+	Version           int64        `avro:"version"`
+	CancelledAt       *time.Time   `avro:"cancelled_at"`
+	CancelReason      string       `avro:"cancel_reason"`
+}
+
+type avroDelivery struct {
+	Name    string `avro:"name"`
+	Phone   string `avro:"phone"`
+	Zip     string `avro:"zip"`
+	City    string `avro:"city"`
+	Address string `avro:"address"`
+	Region  string `avro:"region"`
+	Email   string `avro:"email"`
+}
+
+type avroPayment struct {
+	Transaction  string `avro:"transaction"`
+	RequestID    string `avro:"request_id"`
+	Currency     string `avro:"currency"`
+	Provider     string `avro:"provider"`
+	Amount       int64  `avro:"amount"`
+	PaymentDT    int64  `avro:"payment_dt"`
+	Bank         string `avro:"bank"`
+	DeliveryCost int64  `avro:"delivery_cost"`
+	GoodsTotal   int64  `avro:"goods_total"`
+	CustomFee    int64  `avro:"custom_fee"`
+}
+
+type avroItem struct {
+	ChrtID      int64  `avro:"chrt_id"`
+	TrackNumber string `avro:"track_number"`
+	Price       int64  `avro:"price"`
+	RID         string `avro:"rid"`
+	Name        string `avro:"name"`
+	Sale        int64  `avro:"sale"`
+	Size        string `avro:"size"`
+	TotalPrice  int64  `avro:"total_price"`
+	NmID        int64  `avro:"nm_id"`
+	Brand       string `avro:"brand"`
+	Status      int64  `avro:"status"`
+}
+
+func (r *avroOrder) order() *domain.Order {
+	o := &domain.Order{
+		OrderUID:    r.OrderUID,
+		TrackNumber: r.TrackNumber,
+		Entry:       r.Entry,
+		Delivery: domain.Delivery{
+			Name:    r.Delivery.Name,
+			Phone:   r.Delivery.Phone,
+			Zip:     r.Delivery.Zip,
+			City:    r.Delivery.City,
+			Address: r.Delivery.Address,
+			Region:  r.Delivery.Region,
+			Email:   r.Delivery.Email,
+		},
+		Payment: domain.Payment{
+			Transaction:  r.Payment.Transaction,
+			RequestID:    r.Payment.RequestID,
+			Currency:     r.Payment.Currency,
+			Provider:     r.Payment.Provider,
+			Amount:       int(r.Payment.Amount),
+			PaymentDT:    r.Payment.PaymentDT,
+			Bank:         r.Payment.Bank,
+			DeliveryCost: int(r.Payment.DeliveryCost),
+			GoodsTotal:   int(r.Payment.GoodsTotal),
+			CustomFee:    int(r.Payment.CustomFee),
+		},
+		Locale:            r.Locale,
+		InternalSignature: r.InternalSignature,
+		CustomerID:        r.CustomerID,
+		DeliveryService:   r.DeliveryService,
+		Shardkey:          r.Shardkey,
+		SmID:              int(r.SmID),
+		DateCreated:       r.DateCreated.UTC(),
+		OofShard:          r.OofShard,
+		Version:           r.Version,
+		CancelReason:      r.CancelReason,
+	}
+	if r.CancelledAt != nil {
+		t := r.CancelledAt.UTC()
+		o.CancelledAt = &t
+	}
+	for _, it := range r.Items {
+		o.Items = append(o.Items, domain.Item{
+			ChrtID:      it.ChrtID,
+			TrackNumber: it.TrackNumber,
+			Price:       int(it.Price),
+			RID:         it.RID,
+			Name:        it.Name,
+			Sale:        int(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int(it.TotalPrice),
+			NmID:        it.NmID,
+			Brand:       it.Brand,
+			Status:      int(it.Status),
+		})
+	}
+	return o
+}
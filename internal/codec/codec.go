@@ -0,0 +1,97 @@
+// Package codec decodes order snapshots published in formats other than JSON
+// and turns them into the canonical JSON stored in raw_payload.
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+)
+
+// HeaderContentType is the Kafka header naming the payload format.
+const HeaderContentType = "content-type"
+
+// Content types understood by NewRegistry.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/vnd.confluent.avro"
+)
+
+// magicByte starts every message in the Confluent wire format.
+const magicByte = 0x00
+
+// Codec decodes an order snapshot from its wire format.
+type Codec interface {
+	Decode(ctx context.Context, b []byte) (*domain.Order, error)
+}
+
+// Registry picks a Codec for a message. JSON is not registered: it is left to
+// the caller, which also understands event envelopes.
+type Registry struct {
+	codecs map[string]Codec
+}
+
+// NewRegistry registers the Protobuf codec and, when schemas is not nil, the
+// Avro codec for the Confluent wire format.
+func NewRegistry(schemas SchemaRegistry) *Registry {
+	r := &Registry{codecs: make(map[string]Codec)}
+	r.Register(ContentTypeProtobuf, Protobuf{})
+	if schemas != nil {
+		r.Register(ContentTypeAvro, NewAvro(schemas))
+	}
+	return r
+}
+
+func (r *Registry) Register(contentType string, c Codec) {
+	r.codecs[contentType] = c
+}
+
+// Lookup returns the codec for a message with the given content-type header
+// and value. The header wins; without it a leading magic byte selects Avro.
+// A nil codec and nil error mean the value is JSON.
+func (r *Registry) Lookup(contentType string, value []byte) (Codec, error) {
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+		}
+		if mt == ContentTypeJSON {
+			return nil, nil
+		}
+		if r != nil {
+			if c, ok := r.codecs[mt]; ok {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported content type %q", mt)
+	}
+	if len(value) > 0 && value[0] == magicByte {
+		if r != nil {
+			if c, ok := r.codecs[ContentTypeAvro]; ok {
+				return c, nil
+			}
+		}
+		return nil, errors.New("confluent wire format without a schema registry")
+	}
+	return nil, nil
+}
+
+// Canonical returns the JSON stored in raw_payload for o. Every input format
+// goes through it, so the stored bytes do not depend on how o arrived;
+// timestamps are normalized to UTC for the same reason. The result is stamped
+// with the current domain.SchemaVersion.
+func Canonical(o *domain.Order) ([]byte, error) {
+	c := *o
+	c.SchemaVersion = domain.SchemaVersion
+	c.DateCreated = c.DateCreated.UTC()
+	if c.CancelledAt != nil {
+		t := c.CancelledAt.UTC()
+		c.CancelledAt = &t
+	}
+	return json.Marshal(&c)
+}
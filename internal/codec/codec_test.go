@@ -0,0 +1,263 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+)
+
+const orderFixture = `{
+  "order_uid": "b563feb7b2b84b6test",
+  "track_number": "WBILMTESTTRACK",
+  "entry": "WBIL",
+  "delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin",
+    "address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+  "payment": {"transaction": "b563feb7b2b84b6test", "request_id": "", "currency": "USD", "provider": "wbpay",
+    "amount": 1817, "payment_dt": 1637907727, "bank": "alpha", "delivery_cost": 1500, "goods_total": 317, "custom_fee": 0},
+  "items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "rid": "ab4219087a764ae0btest",
+    "name": "Mascaras", "sale": 30, "size": "0", "total_price": 317, "nm_id": 2389212, "brand": "Vivienne Sabo", "status": 202}],
+  "locale": "en",
+  "internal_signature": "",
+  "customer_id": "test",
+  "delivery_service": "meest",
+  "shardkey": "9",
+  "sm_id": 99,
+  "date_created": "2021-11-26T09:22:19+03:00",
+  "oof_shard": "1"
+}`
+
+func fixture(t *testing.T) *domain.Order {
+	t.Helper()
+	var o domain.Order
+	if err := json.Unmarshal([]byte(orderFixture), &o); err != nil {
+		t.Fatalf("fixture: %v", err)
+	}
+	return &o
+}
+
+func TestCanonicalJSONDoesNotDependOnInputFormat(t *testing.T) {
+	ctx := context.Background()
+	want, err := Canonical(fixture(t))
+	if err != nil {
+		t.Fatalf("canonical: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "7.avsc"), []byte(OrderSchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := NewSchemaRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry(schemas)
+
+	cases := []struct {
+		name        string
+		contentType string
+		value       []byte
+	}{
+		{"protobuf", ContentTypeProtobuf, encodeProtobuf(fixture(t))},
+		{"avro by header", ContentTypeAvro, encodeAvro(t, 7, fixture(t))},
+		{"avro by magic byte", "", encodeAvro(t, 7, fixture(t))},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := reg.Lookup(tc.contentType, tc.value)
+			if err != nil || c == nil {
+				t.Fatalf("lookup: codec=%v err=%v", c, err)
+			}
+			o, err := c.Decode(ctx, tc.value)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			got, err := Canonical(o)
+			if err != nil {
+				t.Fatalf("canonical: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("canonical JSON differs:\n got %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	reg := NewRegistry(nil)
+
+	if c, err := reg.Lookup("", []byte(`{}`)); c != nil || err != nil {
+		t.Fatalf("expected JSON for a plain value, got %v %v", c, err)
+	}
+	if c, err := reg.Lookup("application/json; charset=utf-8", nil); c != nil || err != nil {
+		t.Fatalf("expected JSON for the json content type, got %v %v", c, err)
+	}
+	if _, err := reg.Lookup("text/csv", nil); err == nil {
+		t.Fatalf("expected error for an unsupported content type")
+	}
+	if _, err := reg.Lookup("", []byte{0, 0, 0, 0, 1}); err == nil {
+		t.Fatalf("expected error for avro without a schema registry")
+	}
+}
+
+func TestHTTPSchemaRegistry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schemas/ids/3":
+			json.NewEncoder(w).Encode(map[string]string{"schema": OrderSchema})
+		case "/schemas/ids/5":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	schemas, err := NewSchemaRegistry(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewAvro(schemas).Decode(context.Background(), encodeAvro(t, 3, fixture(t)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if o.OrderUID != "b563feb7b2b84b6test" || len(o.Items) != 1 {
+		t.Fatalf("unexpected order %+v", o)
+	}
+	if _, err := schemas.Schema(context.Background(), 4); err == nil || errors.Is(err, ErrRegistryUnavailable) {
+		t.Fatalf("expected a permanent error for an unknown schema id, got %v", err)
+	}
+	if _, err := NewAvro(schemas).Decode(context.Background(), encodeAvro(t, 5, fixture(t))); !errors.Is(err, ErrRegistryUnavailable) {
+		t.Fatalf("expected ErrRegistryUnavailable for a failing registry, got %v", err)
+	}
+
+	srv.Close()
+	if _, err := schemas.Schema(context.Background(), 6); !errors.Is(err, ErrRegistryUnavailable) {
+		t.Fatalf("expected ErrRegistryUnavailable for an unreachable registry, got %v", err)
+	}
+}
+
+func encodeAvro(t *testing.T, id uint32, o *domain.Order) []byte {
+	t.Helper()
+	rec := avroOrder{
+		OrderUID: o.OrderUID, TrackNumber: o.TrackNumber, Entry: o.Entry,
+		Delivery: avroDelivery(o.Delivery),
+		Payment: avroPayment{
+			Transaction: o.Payment.Transaction, RequestID: o.Payment.RequestID, Currency: o.Payment.Currency,
+			Provider: o.Payment.Provider, Amount: int64(o.Payment.Amount), PaymentDT: o.Payment.PaymentDT,
+			Bank: o.Payment.Bank, DeliveryCost: int64(o.Payment.DeliveryCost),
+			GoodsTotal: int64(o.Payment.GoodsTotal), CustomFee: int64(o.Payment.CustomFee),
+		},
+		Locale: o.Locale, InternalSignature: o.InternalSignature, CustomerID: o.CustomerID,
+		DeliveryService: o.DeliveryService, Shardkey: o.Shardkey, SmID: int64(o.SmID),
+		DateCreated: o.DateCreated, OofShard: o.OofShard, Version: o.Version,
+	}
+	for _, it := range o.Items {
+		rec.Items = append(rec.Items, avroItem{
+			ChrtID: it.ChrtID, TrackNumber: it.TrackNumber, Price: int64(it.Price), RID: it.RID, Name: it.Name,
+			Sale: int64(it.Sale), Size: it.Size, TotalPrice: int64(it.TotalPrice), NmID: it.NmID,
+			Brand: it.Brand, Status: int64(it.Status),
+		})
+	}
+	body, err := avro.Marshal(avro.MustParse(OrderSchema), rec)
+	if err != nil {
+		t.Fatalf("avro marshal: %v", err)
+	}
+	out := []byte{magicByte, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(out[1:], id)
+	return append(out, body...)
+}
+
+func encodeProtobuf(o *domain.Order) []byte {
+	str := func(b []byte, n protowire.Number, s string) []byte {
+		if s == "" {
+			return b
+		}
+		b = protowire.AppendTag(b, n, protowire.BytesType)
+		return protowire.AppendString(b, s)
+	}
+	num := func(b []byte, n protowire.Number, v int64) []byte {
+		if v == 0 {
+			return b
+		}
+		b = protowire.AppendTag(b, n, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v))
+	}
+	msg := func(b []byte, n protowire.Number, m []byte) []byte {
+		b = protowire.AppendTag(b, n, protowire.BytesType)
+		return protowire.AppendBytes(b, m)
+	}
+	ts := func(t time.Time) []byte {
+		return num(num(nil, 1, t.Unix()), 2, int64(t.Nanosecond()))
+	}
+
+	d := o.Delivery
+	var del []byte
+	del = str(del, 1, d.Name)
+	del = str(del, 2, d.Phone)
+	del = str(del, 3, d.Zip)
+	del = str(del, 4, d.City)
+	del = str(del, 5, d.Address)
+	del = str(del, 6, d.Region)
+	del = str(del, 7, d.Email)
+
+	p := o.Payment
+	var pay []byte
+	pay = str(pay, 1, p.Transaction)
+	pay = str(pay, 2, p.RequestID)
+	pay = str(pay, 3, p.Currency)
+	pay = str(pay, 4, p.Provider)
+	pay = num(pay, 5, int64(p.Amount))
+	pay = num(pay, 6, p.PaymentDT)
+	pay = str(pay, 7, p.Bank)
+	pay = num(pay, 8, int64(p.DeliveryCost))
+	pay = num(pay, 9, int64(p.GoodsTotal))
+	pay = num(pay, 10, int64(p.CustomFee))
+
+	var b []byte
+	b = str(b, 1, o.OrderUID)
+	b = str(b, 2, o.TrackNumber)
+	b = str(b, 3, o.Entry)
+	b = msg(b, 4, del)
+	b = msg(b, 5, pay)
+	for _, it := range o.Items {
+		var ib []byte
+		ib = num(ib, 1, it.ChrtID)
+		ib = str(ib, 2, it.TrackNumber)
+		ib = num(ib, 3, int64(it.Price))
+		ib = str(ib, 4, it.RID)
+		ib = str(ib, 5, it.Name)
+		ib = num(ib, 6, int64(it.Sale))
+		ib = str(ib, 7, it.Size)
+		ib = num(ib, 8, int64(it.TotalPrice))
+		ib = num(ib, 9, it.NmID)
+		ib = str(ib, 10, it.Brand)
+		ib = num(ib, 11, int64(it.Status))
+		b = msg(b, 6, ib)
+	}
+	b = str(b, 7, o.Locale)
+	b = str(b, 8, o.InternalSignature)
+	b = str(b, 9, o.CustomerID)
+	b = str(b, 10, o.DeliveryService)
+	b = str(b, 11, o.Shardkey)
+	b = num(b, 12, int64(o.SmID))
+	b = msg(b, 13, ts(o.DateCreated))
+	b = str(b, 14, o.OofShard)
+	b = num(b, 15, o.Version)
+	// An unknown field must be skipped.
+	b = protowire.AppendTag(b, 99, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 42)
+	return b
+}
@@ -0,0 +1,211 @@
+package codec
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+)
+
+// Protobuf decodes orders.v1.Order messages (see order.proto) straight from
+// the wire format. Unknown fields are skipped, as protobuf requires.
+type Protobuf struct{}
+
+func (Protobuf) Decode(_ context.Context, b []byte) (*domain.Order, error) {
+	var o domain.Order
+	err := walk(b, func(f field) error {
+		switch f.num {
+		case 1:
+			o.OrderUID = f.str()
+		case 2:
+			o.TrackNumber = f.str()
+		case 3:
+			o.Entry = f.str()
+		case 4:
+			return walk(f.bytes, func(f field) error { return decodeDelivery(&o.Delivery, f) })
+		case 5:
+			return walk(f.bytes, func(f field) error { return decodePayment(&o.Payment, f) })
+		case 6:
+			var it domain.Item
+			if err := walk(f.bytes, func(f field) error { return decodeItem(&it, f) }); err != nil {
+				return err
+			}
+			o.Items = append(o.Items, it)
+		case 7:
+			o.Locale = f.str()
+		case 8:
+			o.InternalSignature = f.str()
+		case 9:
+			o.CustomerID = f.str()
+		case 10:
+			o.DeliveryService = f.str()
+		case 11:
+			o.Shardkey = f.str()
+		case 12:
+			o.SmID = int(f.int())
+		case 13:
+			t, err := decodeTimestamp(f.bytes)
+			if err != nil {
+				return err
+			}
+			o.DateCreated = t
+		case 14:
+			o.OofShard = f.str()
+		case 15:
+			o.Version = f.int()
+		case 16:
+			t, err := decodeTimestamp(f.bytes)
+			if err != nil {
+				return err
+			}
+			o.CancelledAt = &t
+		case 17:
+			o.CancelReason = f.str()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("protobuf order: %w", err)
+	}
+	return &o, nil
+}
+
+func decodeDelivery(d *domain.Delivery, f field) error {
+	switch f.num {
+	case 1:
+		d.Name = f.str()
+	case 2:
+		d.Phone = f.str()
+	case 3:
+		d.Zip = f.str()
+	case 4:
+		d.City = f.str()
+	case 5:
+		d.Address = f.str()
+	case 6:
+		d.Region = f.str()
+	case 7:
+		d.Email = f.str()
+	}
+	return nil
+}
+
+func decodePayment(p *domain.Payment, f field) error {
+	switch f.num {
+	case 1:
+		p.Transaction = f.str()
+	case 2:
+		p.RequestID = f.str()
+	case 3:
+		p.Currency = f.str()
+	case 4:
+		p.Provider = f.str()
+	case 5:
+		p.Amount = int(f.int())
+	case 6:
+		p.PaymentDT = f.int()
+	case 7:
+		p.Bank = f.str()
+	case 8:
+		p.DeliveryCost = int(f.int())
+	case 9:
+		p.GoodsTotal = int(f.int())
+	case 10:
+		p.CustomFee = int(f.int())
+	}
+	return nil
+}
+
+func decodeItem(it *domain.Item, f field) error {
+	switch f.num {
+	case 1:
+		it.ChrtID = f.int()
+	case 2:
+		it.TrackNumber = f.str()
+	case 3:
+		it.Price = int(f.int())
+	case 4:
+		it.RID = f.str()
+	case 5:
+		it.Name = f.str()
+	case 6:
+		it.Sale = int(f.int())
+	case 7:
+		it.Size = f.str()
+	case 8:
+		it.TotalPrice = int(f.int())
+	case 9:
+		it.NmID = f.int()
+	case 10:
+		it.Brand = f.str()
+	case 11:
+		it.Status = int(f.int())
+	}
+	return nil
+}
+
+// decodeTimestamp decodes a google.protobuf.Timestamp message.
+func decodeTimestamp(b []byte) (time.Time, error) {
+	var secs, nanos int64
+	err := walk(b, func(f field) error {
+		switch f.num {
+		case 1:
+			secs = f.int()
+		case 2:
+			nanos = f.int()
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, nanos).UTC(), nil
+}
+
+// field is one decoded field; varint carries the value of varint fields and
+// bytes the payload of length-delimited ones.
+type field struct {
+	num    protowire.Number
+	varint uint64
+	bytes  []byte
+}
+
+func (f field) str() string { return string(f.bytes) }
+func (f field) int() int64  { return int64(f.varint) }
+
+// walk calls fn for every varint and length-delimited field of b.
+func walk(b []byte, fn func(field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
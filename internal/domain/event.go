@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventType names the kind of change carried by an order event.
+type EventType string
+
+const (
+	EventSnapshot   EventType = "order.snapshot"
+	EventItemStatus EventType = "order.item_status"
+	EventDelivery   EventType = "order.delivery"
+	EventPayment    EventType = "order.payment"
+	EventCancelled  EventType = "order.cancelled"
+)
+
+// Envelope wraps an event payload together with its type. Messages without an
+// envelope are treated as full order snapshots.
+type Envelope struct {
+	Type    EventType       `json:"type"`
+	Version int64           `json:"version,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Patch is a partial update of a stored order.
+type Patch interface {
+	OrderID() string
+	Apply(o *Order) error
+}
+
+// ItemStatusPatch changes the status of the items with the given chrt_id
+// (and rid, when set).
+type ItemStatusPatch struct {
+	OrderUID string `json:"order_uid" validate:"required,alphanumunicode,max=64"`
+	ChrtID   int64  `json:"chrt_id" validate:"gt=0"`
+	RID      string `json:"rid,omitempty" validate:"omitempty,printascii,max=64"`
+	Status   int    `json:"status" validate:"gte=0"`
+}
+
+func (p *ItemStatusPatch) OrderID() string { return p.OrderUID }
+
+func (p *ItemStatusPatch) Apply(o *Order) error {
+	found := false
+	for i := range o.Items {
+		it := &o.Items[i]
+		if it.ChrtID != p.ChrtID || (p.RID != "" && it.RID != p.RID) {
+			continue
+		}
+		it.Status = p.Status
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("order %s has no item chrt_id=%d", o.OrderUID, p.ChrtID)
+	}
+	return nil
+}
+
+// DeliveryPatch overwrites the delivery fields that are set.
+type DeliveryPatch struct {
+	OrderUID string  `json:"order_uid" validate:"required,alphanumunicode,max=64"`
+	Name     *string `json:"name,omitempty" validate:"omitempty,printascii,max=128"`
+	Phone    *string `json:"phone,omitempty" validate:"omitempty,e164"`
+	Zip      *string `json:"zip,omitempty" validate:"omitempty,numeric"`
+	City     *string `json:"city,omitempty" validate:"omitempty,printascii,max=128"`
+	Address  *string `json:"address,omitempty" validate:"omitempty,printascii,max=256"`
+	Region   *string `json:"region,omitempty" validate:"omitempty,printascii,max=128"`
+	Email    *string `json:"email,omitempty" validate:"omitempty,email"`
+}
+
+func (p *DeliveryPatch) OrderID() string { return p.OrderUID }
+
+func (p *DeliveryPatch) Apply(o *Order) error {
+	d := &o.Delivery
+	set(&d.Name, p.Name)
+	set(&d.Phone, p.Phone)
+	set(&d.Zip, p.Zip)
+	set(&d.City, p.City)
+	set(&d.Address, p.Address)
+	set(&d.Region, p.Region)
+	set(&d.Email, p.Email)
+	return nil
+}
+
+// PaymentPatch overwrites the payment fields that are set.
+type PaymentPatch struct {
+	OrderUID     string  `json:"order_uid" validate:"required,alphanumunicode,max=64"`
+	RequestID    *string `json:"request_id,omitempty" validate:"omitempty,printascii,max=64"`
+	Currency     *string `json:"currency,omitempty" validate:"omitempty,uppercase,len=3"`
+	Provider     *string `json:"provider,omitempty" validate:"omitempty,printascii,max=64"`
+	Amount       *int    `json:"amount,omitempty" validate:"omitempty,gt=0"`
+	PaymentDT    *int64  `json:"payment_dt,omitempty" validate:"omitempty,gt=0"`
+	Bank         *string `json:"bank,omitempty" validate:"omitempty,printascii,max=64"`
+	DeliveryCost *int    `json:"delivery_cost,omitempty" validate:"omitempty,gte=0"`
+	GoodsTotal   *int    `json:"goods_total,omitempty" validate:"omitempty,gte=0"`
+	CustomFee    *int    `json:"custom_fee,omitempty" validate:"omitempty,gte=0"`
+}
+
+func (p *PaymentPatch) OrderID() string { return p.OrderUID }
+
+func (p *PaymentPatch) Apply(o *Order) error {
+	pm := &o.Payment
+	set(&pm.RequestID, p.RequestID)
+	set(&pm.Currency, p.Currency)
+	set(&pm.Provider, p.Provider)
+	set(&pm.Amount, p.Amount)
+	set(&pm.PaymentDT, p.PaymentDT)
+	set(&pm.Bank, p.Bank)
+	set(&pm.DeliveryCost, p.DeliveryCost)
+	set(&pm.GoodsTotal, p.GoodsTotal)
+	set(&pm.CustomFee, p.CustomFee)
+	return nil
+}
+
+// Cancellation marks the order as cancelled.
+type Cancellation struct {
+	OrderUID    string    `json:"order_uid" validate:"required,alphanumunicode,max=64"`
+	Reason      string    `json:"reason,omitempty" validate:"omitempty,printascii,max=256"`
+	CancelledAt time.Time `json:"cancelled_at"`
+}
+
+func (p *Cancellation) OrderID() string { return p.OrderUID }
+
+func (p *Cancellation) Apply(o *Order) error {
+	at := p.CancelledAt
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	o.CancelledAt = &at
+	o.CancelReason = p.Reason
+	return nil
+}
+
+// NewPatch returns an empty patch for t, or nil when t is not a partial update.
+func NewPatch(t EventType) Patch {
+	switch t {
+	case EventItemStatus:
+		return &ItemStatusPatch{}
+	case EventDelivery:
+		return &DeliveryPatch{}
+	case EventPayment:
+		return &PaymentPatch{}
+	case EventCancelled:
+		return &Cancellation{}
+	default:
+		return nil
+	}
+}
+
+func set[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
@@ -2,21 +2,29 @@ package domain
 
 import "time"
 
+// SchemaVersion is the schema_version of Order as defined here. Payloads of
+// older versions are upcast to it before they are decoded.
+const SchemaVersion = 2
+
 type Order struct {
-	OrderUID          string    `json:"order_uid" validate:"required,alphanumunicode,max=64"`
-	TrackNumber       string    `json:"track_number" validate:"required,printascii,max=64"`
-	Entry             string    `json:"entry" validate:"required,printascii,max=32"`
-	Delivery          Delivery  `json:"delivery" validate:"required"`
-	Payment           Payment   `json:"payment" validate:"required"`
-	Items             []Item    `json:"items" validate:"required,min=1,dive"`
-	Locale            string    `json:"locale" validate:"required,alpha,len=2"`
-	InternalSignature string    `json:"internal_signature" validate:"omitempty,printascii,max=128"`
-	CustomerID        string    `json:"customer_id" validate:"required,printascii,max=64"`
-	DeliveryService   string    `json:"delivery_service" validate:"required,printascii,max=64"`
-	Shardkey          string    `json:"shardkey" validate:"required,numeric"`
-	SmID              int       `json:"sm_id" validate:"gte=0"`
-	DateCreated       time.Time `json:"date_created" validate:"required"`
-	OofShard          string    `json:"oof_shard" validate:"required,numeric"`
+	OrderUID          string     `json:"order_uid" validate:"required,alphanumunicode,max=64"`
+	TrackNumber       string     `json:"track_number" validate:"required,printascii,max=64"`
+	Entry             string     `json:"entry" validate:"required,printascii,max=32"`
+	Delivery          Delivery   `json:"delivery" validate:"required"`
+	Payment           Payment    `json:"payment" validate:"required"`
+	Items             []Item     `json:"items" validate:"required,min=1,dive"`
+	Locale            string     `json:"locale" validate:"required,alpha,len=2"`
+	InternalSignature string     `json:"internal_signature" validate:"omitempty,printascii,max=128"`
+	CustomerID        string     `json:"customer_id" validate:"required,printascii,max=64"`
+	DeliveryService   string     `json:"delivery_service" validate:"required,printascii,max=64"`
+	Shardkey          string     `json:"shardkey" validate:"required,numeric"`
+	SmID              int        `json:"sm_id" validate:"gte=0"`
+	DateCreated       time.Time  `json:"date_created" validate:"required"`
+	OofShard          string     `json:"oof_shard" validate:"required,numeric"`
+	Version           int64      `json:"version,omitempty" validate:"gte=0"`
+	CancelledAt       *time.Time `json:"cancelled_at,omitempty"`
+	CancelReason      string     `json:"cancel_reason,omitempty" validate:"omitempty,printascii,max=256"`
+	SchemaVersion     int        `json:"schema_version,omitempty" validate:"gte=0"`
 }
 
 type Delivery struct {
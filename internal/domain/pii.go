@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+)
+
+// LogRole is the role personal data is masked for when an order is
+// formatted with fmt, as in log lines.
+const LogRole = pii.RoleAnalytics
+
+// MaskPII masks the personal data of o for role r: the delivery name, phone,
+// email and address and the payment transaction.
+func (o *Order) MaskPII(r pii.Role) {
+	o.Delivery = o.Delivery.masked(r)
+	o.Payment = o.Payment.masked(r)
+}
+
+func (d Delivery) masked(r pii.Role) Delivery {
+	d.Name = pii.Name(d.Name, r)
+	d.Phone = pii.Phone(d.Phone, r)
+	d.Email = pii.Email(d.Email, r)
+	d.Address = pii.Address(d.Address, r)
+	return d
+}
+
+func (p Payment) masked(r pii.Role) Payment {
+	p.Transaction = pii.Transaction(p.Transaction, r)
+	return p
+}
+
+// Format prints d with personal data masked for LogRole.
+func (d Delivery) Format(f fmt.State, verb rune) {
+	type plain Delivery
+	fmt.Fprintf(f, fmt.FormatString(f, verb), plain(d.masked(LogRole)))
+}
+
+// Format prints p with the transaction masked for LogRole.
+func (p Payment) Format(f fmt.State, verb rune) {
+	type plain Payment
+	fmt.Fprintf(f, fmt.FormatString(f, verb), plain(p.masked(LogRole)))
+}
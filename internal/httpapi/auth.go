@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/auth"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+)
+
+// AuthObserver counts the requests rejected by RequireScope.
+type AuthObserver interface {
+	AuthFailed(method, reason string)
+}
+
+// Reasons reported to AuthObserver.
+const (
+	authMissingCredentials = "missing_credentials"
+	authInvalidAPIKey      = "invalid_api_key"
+	authInvalidToken       = "invalid_token"
+	authInsufficientScope  = "insufficient_scope"
+	authStoreError         = "store_error"
+)
+
+// Option configures NewHandler.
+type Option func(*handlerOptions)
+
+type handlerOptions struct {
+	auth    *auth.Authenticator
+	authObs AuthObserver
+	limiter *RateLimiter
+}
+
+// WithAuth makes every API route require credentials of a with the route's
+// scope; o, which may be nil, counts the rejections. The lookup page stays
+// public.
+func WithAuth(a *auth.Authenticator, o AuthObserver) Option {
+	return func(opts *handlerOptions) { opts.auth, opts.authObs = a, o }
+}
+
+// WithRateLimit limits the API routes by l.
+func WithRateLimit(l *RateLimiter) Option {
+	return func(opts *handlerOptions) { opts.limiter = l }
+}
+
+// RequireScope serves next only to callers authenticated by a and granted
+// scope, answering 401 without valid credentials and 403 without the scope.
+// The role personal data is masked for follows from the scopes alone and
+// replaces any role already in the request: privileged for callers granted
+// auth.ScopeOrdersReadPII, analytics for those granted
+// auth.ScopeOrdersReadAnalytics, support for the others.
+func RequireScope(next http.Handler, a *auth.Authenticator, o AuthObserver, scope string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			reason := authReason(err)
+			authFailed(r, o, p.Method, reason, err)
+			if reason == authStoreError {
+				writeStoreError(w, r, "authenticate", err)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="orders"`)
+			WriteError(w, r, http.StatusUnauthorized, "valid API key or bearer token required")
+			return
+		}
+		if !p.Has(scope) {
+			authFailed(r, o, p.Method, authInsufficientScope, nil)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="orders", error="insufficient_scope", scope="`+scope+`"`)
+			WriteError(w, r, http.StatusForbidden, "scope "+scope+" required")
+			return
+		}
+
+		role := pii.RoleSupport
+		switch {
+		case p.Has(auth.ScopeOrdersReadPII):
+			role = pii.RolePrivileged
+		case p.Has(auth.ScopeOrdersReadAnalytics):
+			role = pii.RoleAnalytics
+		}
+		ctx := pii.NewContext(auth.NewContext(r.Context(), p), role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func authReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrNoCredentials):
+		return authMissingCredentials
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		return authInvalidAPIKey
+	case errors.Is(err, auth.ErrInvalidToken):
+		return authInvalidToken
+	}
+	return authStoreError
+}
+
+func authFailed(r *http.Request, o AuthObserver, method, reason string, err error) {
+	if method == "" {
+		method = auth.MethodNone
+	}
+	if o != nil {
+		o.AuthFailed(method, reason)
+	}
+	msg := ""
+	if err != nil {
+		msg = " err=" + err.Error()
+	}
+	log.Printf("auth failed: method=%s reason=%s route=%q remote=%s request_id=%s%s",
+		method, reason, r.Pattern, r.RemoteAddr, RequestIDFrom(r.Context()), msg)
+}
@@ -0,0 +1,88 @@
+package httpapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/auth"
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+type authFailures []string
+
+func (f *authFailures) AuthFailed(method, reason string) { *f = append(*f, method+"/"+reason) }
+
+func TestAuthGatesRoutesByScope(t *testing.T) {
+	raw := []byte(`{"order_uid":"A","delivery":{"phone":"+9720000000"}}`)
+	repoMock := &mocks.RepositoryMock{
+		GetOrderRawFunc: func(ctx context.Context, id string) (repo.StoredOrder, error) {
+			return repo.StoredOrder{Raw: raw}, nil
+		},
+	}
+	keys := auth.FileKeys{
+		auth.HashKey("reader"): {Subject: "reader", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeOrdersRead}},
+		auth.HashKey("pii"):    {Subject: "pii", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeOrdersRead, auth.ScopeOrdersReadPII}},
+		auth.HashKey("stats"):  {Subject: "stats", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeOrdersRead, auth.ScopeOrdersReadAnalytics}},
+		auth.HashKey("none"):   {Subject: "none", Method: auth.MethodAPIKey},
+	}
+	var failures authFailures
+	// The default role must not unmask data for callers without the scope.
+	h := httpapi.DefaultRole(httpapi.NewHandler(repoMock, cache.New(10), httpapi.WithAuth(&auth.Authenticator{Keys: keys}, &failures)), pii.RolePrivileged)
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		body   string
+	}{
+		{"no key", "", http.StatusUnauthorized, ""},
+		{"unknown key", "guess", http.StatusUnauthorized, ""},
+		{"no scope", "none", http.StatusForbidden, ""},
+		{"masked", "reader", http.StatusOK, `"phone":"+97*****000"`},
+		{"pii", "pii", http.StatusOK, `"phone":"+9720000000"`},
+		{"analytics", "stats", http.StatusOK, `"phone":"***"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/order/A", nil)
+			if tt.key != "" {
+				req.Header.Set(auth.HeaderAPIKey, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("401 without WWW-Authenticate")
+			}
+			if tt.body != "" && !strings.Contains(rec.Body.String(), tt.body) {
+				t.Fatalf("expected %s in %s", tt.body, rec.Body)
+			}
+		})
+	}
+
+	want := []string{"none/missing_credentials", "api_key/invalid_api_key", "api_key/insufficient_scope"}
+	if len(failures) != len(want) {
+		t.Fatalf("expected failures %v, got %v", want, failures)
+	}
+	for i := range want {
+		if failures[i] != want[i] {
+			t.Fatalf("expected failures %v, got %v", want, failures)
+		}
+	}
+
+	// The lookup page stays public.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("lookup page: %d", rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+	"github.com/kosovrzn/wb-tech-l0/internal/view"
+)
+
+// maxBatchGet is the most order_uids one batchGet request may ask for.
+const maxBatchGet = 100
+
+// Per-order statuses of a batchGet response.
+const (
+	batchFound    = "found"
+	batchNotFound = "not_found"
+)
+
+type batchGetRequest struct {
+	OrderUIDs []string `json:"order_uids"`
+}
+
+type batchGetResult struct {
+	Status string          `json:"status"`
+	Order  json.RawMessage `json:"order,omitempty"`
+}
+
+type batchGetResponse struct {
+	Orders map[string]batchGetResult `json:"orders"`
+}
+
+// batchGetOrders serves POST /orders:batchGet: the requested orders keyed by
+// order_uid, cache hits from the cache and all misses in one query, which
+// then fill the cache. Orders are masked and projected as in GET /order/{id}.
+func batchGetOrders(store repo.Repository, c cache.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := projection(r)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		var req batchGetRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			WriteError(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if len(req.OrderUIDs) == 0 || len(req.OrderUIDs) > maxBatchGet {
+			WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("order_uids must hold between 1 and %d ids", maxBatchGet))
+			return
+		}
+
+		out := batchGetResponse{Orders: make(map[string]batchGetResult, len(req.OrderUIDs))}
+		var misses []string
+		for _, id := range req.OrderUIDs {
+			if id == "" {
+				WriteError(w, r, http.StatusBadRequest, "order_uids must not be empty")
+				return
+			}
+			if _, seen := out.Orders[id]; seen {
+				continue
+			}
+			if e, ok := c.GetEntry(id); ok {
+				out.Orders[id] = batchGetResult{Status: batchFound, Order: e.Body}
+				continue
+			}
+			out.Orders[id] = batchGetResult{Status: batchNotFound}
+			misses = append(misses, id)
+		}
+
+		if len(misses) < len(out.Orders) {
+			if err := charge(r.Context(), classHit); err != nil {
+				writeStoreError(w, r, "batch get orders", err)
+				return
+			}
+		}
+		if len(misses) > 0 {
+			if err := charge(r.Context(), classMiss); err != nil {
+				writeStoreError(w, r, "batch get orders", err)
+				return
+			}
+			loaded, err := store.GetOrdersRaw(r.Context(), misses)
+			if err != nil {
+				writeStoreError(w, r, "batch get orders", err)
+				return
+			}
+			for id, o := range loaded {
+				e := cache.NewEntry(o.Raw, o.UpdatedAt)
+				c.SetEntry(id, e)
+				out.Orders[id] = batchGetResult{Status: batchFound, Order: e.Body}
+			}
+		}
+
+		role := callerRole(r)
+		for id, res := range out.Orders {
+			if res.Status != batchFound {
+				continue
+			}
+			if res.Order, err = view.Render(res.Order, p, role); err != nil {
+				log.Printf("render order %s: %v", id, err)
+				WriteError(w, r, http.StatusInternalServerError, "internal error")
+				return
+			}
+			out.Orders[id] = res
+		}
+
+		setPrivate(w.Header())
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
@@ -0,0 +1,74 @@
+package httpapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func TestBatchGetServesHitsAndLoadsMissesOnce(t *testing.T) {
+	c := cache.New(10)
+	c.Set("A", []byte(`{"order_uid":"A"}`))
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.GetOrdersRawFunc = func(ctx context.Context, ids []string) (map[string]repo.StoredOrder, error) {
+		return map[string]repo.StoredOrder{"B": {Raw: []byte(`{"order_uid":"B"}`)}}, nil
+	}
+	handler := httpapi.DefaultRole(httpapi.NewHandler(repoMock, c), pii.RolePrivileged)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders:batchGet",
+		strings.NewReader(`{"order_uids":["A","B","C","B"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Cache-Control") != "private" {
+		t.Fatalf("expected Cache-Control: private on a role-dependent body")
+	}
+
+	var res struct {
+		Orders map[string]struct {
+			Status string          `json:"status"`
+			Order  json.RawMessage `json:"order"`
+		} `json:"orders"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Orders) != 3 ||
+		res.Orders["A"].Status != "found" || string(res.Orders["A"].Order) != `{"order_uid":"A"}` ||
+		res.Orders["B"].Status != "found" || string(res.Orders["B"].Order) != `{"order_uid":"B"}` ||
+		res.Orders["C"].Status != "not_found" || res.Orders["C"].Order != nil {
+		t.Fatalf("unexpected response: %s", rec.Body)
+	}
+
+	calls := repoMock.GetOrdersRawCalls()
+	if len(calls) != 1 || !slices.Equal(calls[0].IDs, []string{"B", "C"}) {
+		t.Fatalf("expected one query for the misses, got %+v", calls)
+	}
+	if _, ok := c.Get("B"); !ok {
+		t.Fatalf("loaded order not cached")
+	}
+}
+
+func TestBatchGetRejectsInvalidRequests(t *testing.T) {
+	handler := httpapi.NewHandler(&mocks.RepositoryMock{}, cache.New(10))
+	tooMany := `{"order_uids":["` + strings.Repeat(`x","`, 100) + `x"]}`
+	for _, body := range []string{`{}`, `{"order_uids":[]}`, `{"order_uids":[""]}`, `nope`, tooMany} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders:batchGet", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%.40s: expected 400, got %d", body, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package httpapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/view"
+)
+
+// minCompressSize is the smallest body worth compressing.
+const minCompressSize = 512
+
+// encoders are the content codings orders are served in besides identity,
+// most preferred first. Each entry is compressed once and cached with it.
+var encoders = []struct {
+	name   string
+	encode func([]byte) ([]byte, error)
+}{
+	{"br", func(b []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		err := w.Close()
+		return buf.Bytes(), err
+	}},
+	{"gzip", func(b []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		err := w.Close()
+		return buf.Bytes(), err
+	}},
+}
+
+// writeOrder serves the order in e, masked for the caller and projected by
+// p: 304 when the client's
+// copy is current, otherwise the body in the best encoding the client accepts.
+func writeOrder(w http.ResponseWriter, r *http.Request, e *cache.Entry, hit bool, p *view.Projection) {
+	e, err := render(e, p, callerRole(r))
+	if err != nil {
+		log.Printf("render order: %v", err)
+		WriteError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	h := w.Header()
+	if hit {
+		h.Set("X-Cache", "HIT")
+	} else {
+		h.Set("X-Cache", "MISS")
+	}
+	setPrivate(h)
+	h.Set("Vary", "Accept-Encoding")
+	if !e.LastModified.IsZero() {
+		h.Set("Last-Modified", e.LastModified.Format(http.TimeFormat))
+	}
+
+	body, enc := e.Body, ""
+	if len(e.Body) >= minCompressSize {
+		if i := negotiateEncoding(r.Header.Get("Accept-Encoding")); i >= 0 {
+			b, err := e.Encoded(encoders[i].name, encoders[i].encode)
+			if err != nil {
+				log.Printf("encode order as %s: %v", encoders[i].name, err)
+			} else {
+				body, enc = b, encoders[i].name
+			}
+		}
+	}
+	// Each encoding is a representation of its own and gets its own strong
+	// ETag; they all validate against the entry.
+	if enc != "" {
+		h.Set("ETag", strings.TrimSuffix(e.ETag, `"`)+"-"+enc+`"`)
+	} else {
+		h.Set("ETag", e.ETag)
+	}
+
+	if notModified(r, e) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", "application/json")
+	if enc != "" {
+		h.Set("Content-Encoding", enc)
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(body)
+}
+
+// notModified evaluates If-None-Match or, without it, If-Modified-Since
+// against e, as RFC 9110 section 13.2.2 orders them.
+func notModified(r *http.Request, e *cache.Entry) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || baseETag(tag) == e.ETag {
+				return true
+			}
+		}
+		return false
+	}
+	if e.LastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !e.LastModified.After(t)
+}
+
+// baseETag strips the encoding suffix writeOrder adds to tag.
+func baseETag(tag string) string {
+	for _, enc := range encoders {
+		if s, ok := strings.CutSuffix(tag, "-"+enc.name+`"`); ok {
+			return s + `"`
+		}
+	}
+	return tag
+}
+
+// negotiateEncoding returns the index in encoders of the coding preferred by
+// the Accept-Encoding header, or -1 for identity. Ties go to the order of
+// encoders.
+func negotiateEncoding(header string) int {
+	if header == "" {
+		return -1
+	}
+	q := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+
+	best, bestQ := -1, 0.0
+	for i, enc := range encoders {
+		w, ok := q[enc.name]
+		if !ok {
+			w = q["*"]
+		}
+		if w > bestQ {
+			best, bestQ = i, w
+		}
+	}
+	return best
+}
@@ -0,0 +1,138 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+var updatedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func conditionalHandler(raw []byte) (http.Handler, *cache.Cache) {
+	c := cache.New(10)
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.GetOrderRawFunc = func(ctx context.Context, id string) (repo.StoredOrder, error) {
+		return repo.StoredOrder{Raw: raw, UpdatedAt: updatedAt}, nil
+	}
+	return httpapi.DefaultRole(httpapi.NewHandler(repoMock, c), pii.RolePrivileged), c
+}
+
+func get(h http.Handler, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/order/A", nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOrderHandlerAnswersConditionalRequests(t *testing.T) {
+	h, _ := conditionalHandler([]byte(`{"order_uid":"A"}`))
+
+	first := get(h)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("unexpected first response: %d etag=%q", first.Code, etag)
+	}
+	if got := first.Header().Get("Last-Modified"); got != "Wed, 01 May 2024 12:00:00 GMT" {
+		t.Fatalf("unexpected Last-Modified %q", got)
+	}
+
+	tests := []struct {
+		name    string
+		headers []string
+		status  int
+	}{
+		{"matching etag", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"etag in list", []string{"If-None-Match", `"other", W/` + etag}, http.StatusNotModified},
+		{"stale etag", []string{"If-None-Match", `"other"`}, http.StatusOK},
+		{"not modified since", []string{"If-Modified-Since", "Wed, 01 May 2024 12:00:00 GMT"}, http.StatusNotModified},
+		{"modified since", []string{"If-Modified-Since", "Wed, 01 May 2024 11:59:59 GMT"}, http.StatusOK},
+		{"etag wins over date", []string{"If-None-Match", `"other"`, "If-Modified-Since", "Wed, 01 May 2024 12:00:00 GMT"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(h, tt.headers...)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Fatalf("304 with body %q", rec.Body)
+			}
+		})
+	}
+}
+
+func TestOrderHandlerCompressesOnce(t *testing.T) {
+	raw := []byte(`{"order_uid":"A","items":[` + strings.Repeat(`{"name":"Mascaras","brand":"Vivienne Sabo"},`, 30) + `{}]}`)
+	h, c := conditionalHandler(raw)
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	}
+	for _, tt := range []struct{ accept, enc string }{
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"*", "br"},
+		{"br;q=0, gzip;q=0", ""},
+		{"", ""},
+	} {
+		rec := get(h, "Accept-Encoding", tt.accept)
+		if got := rec.Header().Get("Content-Encoding"); got != tt.enc {
+			t.Fatalf("Accept-Encoding %q: expected encoding %q, got %q", tt.accept, tt.enc, got)
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("missing Vary header")
+		}
+		if rec.Header().Get("Cache-Control") != "private" {
+			t.Fatalf("expected Cache-Control: private on a role-dependent body")
+		}
+		body := rec.Body.Bytes()
+		if tt.enc != "" {
+			r, err := decoders[tt.enc](bytes.NewReader(body))
+			if err == nil {
+				body, err = io.ReadAll(r)
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.enc, err)
+			}
+		}
+		if !bytes.Equal(body, raw) {
+			t.Fatalf("Accept-Encoding %q: body does not round-trip", tt.accept)
+		}
+	}
+
+	// The compressed forms live in the cache entry and are not recomputed.
+	e, _ := c.GetEntry("A")
+	for enc := range decoders {
+		if _, err := e.Encoded(enc, func([]byte) ([]byte, error) {
+			t.Fatalf("%s recomputed", enc)
+			return nil, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A compressed representation validates against its own ETag.
+	gz := get(h, "Accept-Encoding", "gzip")
+	if rec := get(h, "Accept-Encoding", "gzip", "If-None-Match", gz.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+}
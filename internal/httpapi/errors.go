@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+// HeaderRequestID carries the request id; an incoming one is kept, otherwise
+// one is generated. It is echoed in every response and error body.
+const HeaderRequestID = "X-Request-ID"
+
+// retryAfter is the Retry-After of 503 answers, in seconds.
+const retryAfter = "5"
+
+// statusClientClosedRequest is recorded when the client went away before the
+// answer was ready; nobody reads it.
+const statusClientClosedRequest = 499
+
+type requestIDKey struct{}
+
+// RequestID assigns every request an id. It must wrap the outermost mux:
+// Instrument reads the route pattern the mux sets on the request, which a
+// middleware between them would hide by copying the request.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns the id assigned by RequestID, if any.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type errorBody struct {
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+// WriteError answers with status and a JSON error body:
+//
+//	{"error": "not_found", "message": "order not found", "request_id": "..."}
+//
+// error is a stable machine-readable code derived from status.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	id := RequestIDFrom(r.Context())
+	if id == "" {
+		if id = w.Header().Get(HeaderRequestID); id == "" {
+			id = newRequestID()
+			w.Header().Set(HeaderRequestID, id)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorBody{Error: errorCode(status), Message: message, RequestID: id})
+}
+
+func errorCode(status int) string {
+	if status == statusClientClosedRequest {
+		return "client_closed_request"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// writeStoreError maps a repository error to an answer: 404 for a missing
+// order, 429 when the query was refused by the rate limiter, 504 when the
+// deadline ran out, 503 with Retry-After when the database is unreachable and
+// 500 otherwise. op prefixes the log line.
+func writeStoreError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	if limited, ok := asRateLimited(err); ok {
+		writeRateLimited(w, r, limited)
+		return
+	}
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		WriteError(w, r, http.StatusNotFound, "order not found")
+	case errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err):
+		log.Printf("%s: %v", op, err)
+		WriteError(w, r, http.StatusGatewayTimeout, "database did not answer in time")
+	case errors.Is(err, context.Canceled):
+		WriteError(w, r, statusClientClosedRequest, "request cancelled")
+	case unavailable(err):
+		log.Printf("%s: %v", op, err)
+		w.Header().Set("Retry-After", retryAfter)
+		WriteError(w, r, http.StatusServiceUnavailable, "database unavailable")
+	default:
+		log.Printf("%s: %v", op, err)
+		WriteError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// unavailable reports whether err means the database could not be reached
+// or dropped the connection, as opposed to a failing query.
+func unavailable(err error) bool {
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exception; 57P01-57P03 are shutdowns and
+		// "cannot connect now" during startup or recovery.
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		pgconn.SafeToRetry(err)
+}
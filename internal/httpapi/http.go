@@ -4,12 +4,34 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/kosovrzn/wb-tech-l0/internal/auth"
 	"github.com/kosovrzn/wb-tech-l0/internal/cache"
 	"github.com/kosovrzn/wb-tech-l0/internal/repo"
 )
 
-func NewHandler(store repo.Repository, c cache.Store) http.Handler {
+func NewHandler(store repo.Repository, c cache.Store, opts ...Option) http.Handler {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	mux := http.NewServeMux()
+	// handle registers an API route, rate limited under the route name and
+	// gated by scope when enabled. Callers are authenticated first, so they
+	// are limited by their principal; failed authentications are limited by
+	// IP before that.
+	handle := func(route, pattern, scope string, h http.HandlerFunc) {
+		var next http.Handler = h
+		if o.limiter != nil {
+			next = o.limiter.wrap(route, next)
+		}
+		if o.auth != nil {
+			next = RequireScope(next, o.auth, o.authObs, scope)
+			if o.limiter != nil {
+				next = o.limiter.GuardAuth(next)
+			}
+		}
+		mux.Handle(pattern, next)
+	}
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -19,6 +41,7 @@ func NewHandler(store repo.Repository, c cache.Store) http.Handler {
 <h3>Find Order</h3>
 <input id="oid" placeholder="order_uid" style="width:420px;padding:6px;">
 <button onclick="go()">Get</button>
+<p><input id="key" type="password" placeholder="API key (if required)" style="width:420px;padding:6px;"></p>
 <pre id="out" style="background:#f5f5f5;padding:12px;white-space:pre-wrap;word-break:break-word;font-family:ui-monospace,Menlo,Consolas,monospace;"></pre>
 <script>
 async function go(){
@@ -28,8 +51,13 @@ async function go(){
   const out = document.getElementById('out');
   out.textContent = 'Loading...';
 
-  const r = await fetch('/order/' + encodeURIComponent(id));
-  if (!r.ok) { out.textContent = 'Not found'; return; }
+  const key = document.getElementById('key').value.trim();
+  const r = await fetch('/order/' + encodeURIComponent(id), key ? {headers: {'X-API-Key': key}} : {});
+  if (!r.ok) {
+    const e = await r.json().catch(() => null);
+    out.textContent = e ? e.message + ' (request_id: ' + e.request_id + ')' : 'Error ' + r.status;
+    return;
+  }
 
   const data = await r.json(); // <-- парсим JSON
   out.textContent = JSON.stringify(data, null, 2); // <-- pretty print
@@ -38,31 +66,39 @@ async function go(){
 </body></html>`))
 	})
 
-	mux.HandleFunc("/order/", func(w http.ResponseWriter, r *http.Request) {
+	handle(RouteList, "GET /orders", auth.ScopeOrdersRead, listOrders(store))
+	handle(RouteBatchGet, "POST /orders:batchGet", auth.ScopeOrdersRead, batchGetOrders(store, c))
+
+	handle(RouteOrder, "/order/", auth.ScopeOrdersRead, func(w http.ResponseWriter, r *http.Request) {
 		id := strings.TrimPrefix(r.URL.Path, "/order/")
 		if id == "" {
-			http.Error(w, "missing order id", http.StatusBadRequest)
+			WriteError(w, r, http.StatusBadRequest, "missing order id")
 			return
 		}
-
-		if v, ok := c.Get(id); ok {
-			w.Header().Set("X-Cache", "HIT")
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(v)
-			return
-		}
-		w.Header().Set("X-Cache", "MISS")
-
-		raw, err := store.GetOrderRaw(r.Context(), id)
-		if err != nil {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-
-		c.Set(id, raw)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(raw)
+		serveOrder(w, r, store, c, id)
 	})
 
+	aliases := cache.New(aliasCapacity)
+	handle(RouteLookup, "GET /orders/by-track/{track}", auth.ScopeOrdersRead, lookupOrder(store, c, aliases, repo.LookupTrackNumber, "track"))
+	handle(RouteLookup, "GET /orders/by-transaction/{tx}", auth.ScopeOrdersRead, lookupOrder(store, c, aliases, repo.LookupTransaction, "tx"))
+	handle(RouteLookup, "GET /orders/by-rid/{rid}", auth.ScopeOrdersRead, lookupOrder(store, c, aliases, repo.LookupRID, "rid"))
+
 	return mux
 }
+
+// serveOrder writes order id from the cache or, on a miss, from the store,
+// caching it for the next request. Conditional requests and compression are
+// handled by writeOrder.
+func serveOrder(w http.ResponseWriter, r *http.Request, store repo.Repository, c cache.Store, id string) {
+	p, err := projection(r)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	e, hit, err := loadOrder(r.Context(), store, c, id)
+	if err != nil {
+		writeStoreError(w, r, "get order "+id, err)
+		return
+	}
+	writeOrder(w, r, e, hit, p)
+}
@@ -3,36 +3,45 @@ package httpapi_test
 import (
 	"bytes"
 	"context"
-	"errors"
+	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
 	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
 	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
 )
 
 func TestOrderHandlerReturnsCachedValue(t *testing.T) {
 	raw := []byte(`{"order_uid":"cached"}`)
 
 	cacheMock := &mocks.StoreMock{
-		GetFunc: func(id string) ([]byte, bool) {
+		GetEntryFunc: func(id string) (*cache.Entry, bool) {
 			if id != "cached" {
 				t.Fatalf("unexpected cache key: %s", id)
 			}
-			return raw, true
+			return cache.NewEntry(raw, time.Now()), true
 		},
-		SetFunc: func(string, []byte) {
+		SetEntryFunc: func(string, *cache.Entry) {
 			t.Fatalf("unexpected cache Set call")
 		},
 	}
 	repoMock := &mocks.RepositoryMock{}
-	repoMock.GetOrderRawFunc = func(ctx context.Context, id string) ([]byte, error) {
+	repoMock.GetOrderRawFunc = func(ctx context.Context, id string) (repo.StoredOrder, error) {
 		t.Fatalf("repository should not be called on cache hit")
-		return nil, nil
+		return repo.StoredOrder{}, nil
 	}
 
-	handler := httpapi.NewHandler(repoMock, cacheMock)
+	handler := httpapi.DefaultRole(httpapi.NewHandler(repoMock, cacheMock), pii.RolePrivileged)
 	req := httptest.NewRequest(http.MethodGet, "/order/cached", nil)
 	rec := httptest.NewRecorder()
 
@@ -59,32 +68,32 @@ func TestOrderHandlerLoadsFromRepoOnCacheMiss(t *testing.T) {
 	cacheStored := false
 
 	cacheMock := &mocks.StoreMock{
-		GetFunc: func(id string) ([]byte, bool) {
+		GetEntryFunc: func(id string) (*cache.Entry, bool) {
 			return nil, false
 		},
-		SetFunc: func(id string, b []byte) {
+		SetEntryFunc: func(id string, e *cache.Entry) {
 			cacheStored = true
 			if id != "repo" {
 				t.Fatalf("unexpected id in cache set: %s", id)
 			}
-			if !bytes.Equal(b, raw) {
-				t.Fatalf("cache stored unexpected data: %s", string(b))
+			if !bytes.Equal(e.Body, raw) {
+				t.Fatalf("cache stored unexpected data: %s", string(e.Body))
 			}
 		},
 	}
 
 	repoMock := &mocks.RepositoryMock{}
-	repoMock.GetOrderRawFunc = func(ctx context.Context, id string) ([]byte, error) {
+	repoMock.GetOrderRawFunc = func(ctx context.Context, id string) (repo.StoredOrder, error) {
 		if id != "repo" {
 			t.Fatalf("unexpected repo id: %s", id)
 		}
 		if ctx == nil {
 			t.Fatalf("expected context to be passed")
 		}
-		return raw, nil
+		return repo.StoredOrder{Raw: raw, UpdatedAt: time.Now()}, nil
 	}
 
-	handler := httpapi.NewHandler(repoMock, cacheMock)
+	handler := httpapi.DefaultRole(httpapi.NewHandler(repoMock, cacheMock), pii.RolePrivileged)
 	req := httptest.NewRequest(http.MethodGet, "/order/repo", nil)
 	rec := httptest.NewRecorder()
 
@@ -107,23 +116,100 @@ func TestOrderHandlerLoadsFromRepoOnCacheMiss(t *testing.T) {
 	}
 }
 
-func TestOrderHandlerHandlesMissingOrder(t *testing.T) {
-	cacheMock := &mocks.StoreMock{
-		GetFunc: func(string) ([]byte, bool) { return nil, false },
-		SetFunc: func(string, []byte) {},
+func TestOrderHandlerMapsRepositoryErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		code       string
+		retryAfter string
+	}{
+		{"missing order", fmt.Errorf("order missing: %w", repo.ErrNotFound), http.StatusNotFound, "not_found", ""},
+		{"deadline exceeded", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "gateway_timeout", ""},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, http.StatusServiceUnavailable, "service_unavailable", "5"},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, http.StatusServiceUnavailable, "service_unavailable", "5"},
+		{"query error", &pgconn.PgError{Code: "42P01"}, http.StatusInternalServerError, "internal_server_error", ""},
 	}
-	repoMock := &mocks.RepositoryMock{}
-	repoMock.GetOrderRawFunc = func(ctx context.Context, id string) ([]byte, error) {
-		return nil, errors.New("not found")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheMock := &mocks.StoreMock{
+				GetEntryFunc: func(string) (*cache.Entry, bool) { return nil, false },
+				SetEntryFunc: func(string, *cache.Entry) { t.Fatalf("failed lookup must not be cached") },
+			}
+			repoMock := &mocks.RepositoryMock{}
+			repoMock.GetOrderRawFunc = func(ctx context.Context, id string) (repo.StoredOrder, error) {
+				return repo.StoredOrder{}, tt.err
+			}
+
+			handler := httpapi.RequestID(httpapi.NewHandler(repoMock, cacheMock))
+			req := httptest.NewRequest(http.MethodGet, "/order/missing", nil)
+			req.Header.Set(httpapi.HeaderRequestID, "req-42")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Fatalf("expected Retry-After=%q, got %q", tt.retryAfter, got)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Fatalf("expected JSON error, got %s", got)
+			}
+			if got := rec.Header().Get(httpapi.HeaderRequestID); got != "req-42" {
+				t.Fatalf("expected request id to be echoed, got %q", got)
+			}
+			var body struct {
+				Error     string `json:"error"`
+				Message   string `json:"message"`
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid error body %q: %v", rec.Body, err)
+			}
+			if body.Error != tt.code || body.Message == "" || body.RequestID != "req-42" {
+				t.Fatalf("unexpected error body: %+v", body)
+			}
+		})
 	}
+}
 
-	handler := httpapi.NewHandler(repoMock, cacheMock)
-	req := httptest.NewRequest(http.MethodGet, "/order/missing", nil)
+func TestRequestIDIsGeneratedWhenMissing(t *testing.T) {
+	handler := httpapi.RequestID(httpapi.NewHandler(&mocks.RepositoryMock{}, &mocks.StoreMock{}))
 	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?limit=0", nil))
 
-	handler.ServeHTTP(rec, req)
+	id := rec.Header().Get(httpapi.HeaderRequestID)
+	if rec.Code != http.StatusBadRequest || id == "" {
+		t.Fatalf("unexpected response: %d, request id %q", rec.Code, id)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte(`"request_id":"`+id+`"`)) {
+		t.Fatalf("request id missing from body: %s", rec.Body)
+	}
+}
+
+type requestRecorder struct {
+	route  string
+	status int
+}
+
+func (r *requestRecorder) ObserveRequest(route string, status int, _ time.Duration) {
+	r.route, r.status = route, status
+}
+
+func TestInstrumentReportsRoutePattern(t *testing.T) {
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.GetOrderRawFunc = func(context.Context, string) (repo.StoredOrder, error) {
+		return repo.StoredOrder{}, repo.ErrNotFound
+	}
+	cacheMock := &mocks.StoreMock{GetEntryFunc: func(string) (*cache.Entry, bool) { return nil, false }}
+
+	obs := &requestRecorder{}
+	handler := httpapi.RequestID(httpapi.Instrument(httpapi.NewHandler(repoMock, cacheMock), obs))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/order/ORDER42", nil))
 
-	if rec.Code != http.StatusNotFound {
-		t.Fatalf("expected 404, got %d", rec.Code)
+	if obs.route != "/order/" || obs.status != http.StatusNotFound {
+		t.Fatalf("unexpected observation: route=%q status=%d", obs.route, obs.status)
 	}
 }
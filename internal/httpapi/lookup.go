@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+// aliasCapacity bounds the cache of resolved order_uids.
+const aliasCapacity = 10000
+
+// lookupOrder serves an order found by key, whose value is the path wildcard
+// param. The resolved order_uid is cached in aliases, apart from the orders
+// so that it can neither be served as one nor evict one; a repeated lookup
+// costs two cache hits and no query.
+func lookupOrder(store repo.Repository, c, aliases cache.Store, key repo.LookupKey, param string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := projection(r)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		value := r.PathValue(param)
+		alias := lookupCacheKey(key, value)
+
+		for attempt := 0; attempt < 2; attempt++ {
+			var uid string
+			fromCache := false
+			if v, ok := aliases.Get(alias); ok && attempt == 0 {
+				uid, fromCache = string(v), true
+			} else {
+				if err := charge(r.Context(), classMiss); err != nil {
+					writeStoreError(w, r, "lookup by "+string(key), err)
+					return
+				}
+				id, err := store.LookupOrderUID(r.Context(), key, value)
+				if err != nil {
+					writeStoreError(w, r, "lookup by "+string(key), err)
+					return
+				}
+				uid = id
+				aliases.Set(alias, []byte(id))
+			}
+
+			e, hit, err := loadOrder(r.Context(), store, c, uid)
+			if err != nil && !errors.Is(err, repo.ErrNotFound) {
+				writeStoreError(w, r, "get order "+uid, err)
+				return
+			}
+			// A cached alias goes stale when its order is deleted or patched
+			// to another value; it is then dropped and resolved again.
+			if err == nil && (!fromCache || matchesLookup(e.Body, key, value)) {
+				writeOrder(w, r, e, fromCache && hit, p)
+				return
+			}
+			if !fromCache {
+				break
+			}
+			aliases.Delete(alias)
+		}
+		WriteError(w, r, http.StatusNotFound, "order not found")
+	}
+}
+
+// lookupCacheKey is the alias cache key of the order_uid found by key.
+func lookupCacheKey(key repo.LookupKey, value string) string {
+	return "by-" + string(key) + ":" + value
+}
+
+// loadOrder returns order id from the cache or the store and whether it was
+// a cache hit, caching it on a miss. The request is charged as a hit or a
+// miss first.
+func loadOrder(ctx context.Context, store repo.Repository, c cache.Store, id string) (*cache.Entry, bool, error) {
+	if e, ok := c.GetEntry(id); ok {
+		if err := charge(ctx, classHit); err != nil {
+			return nil, true, err
+		}
+		return e, true, nil
+	}
+	if err := charge(ctx, classMiss); err != nil {
+		return nil, false, err
+	}
+	o, err := store.GetOrderRaw(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	e := cache.NewEntry(o.Raw, o.UpdatedAt)
+	c.SetEntry(id, e)
+	return e, false, nil
+}
+
+// matchesLookup reports whether order raw still has value under key.
+func matchesLookup(raw []byte, key repo.LookupKey, value string) bool {
+	var o domain.Order
+	if err := json.Unmarshal(raw, &o); err != nil {
+		return false
+	}
+	switch key {
+	case repo.LookupTrackNumber:
+		return o.TrackNumber == value
+	case repo.LookupTransaction:
+		return o.Payment.Transaction == value
+	case repo.LookupRID:
+		for _, it := range o.Items {
+			if it.RID == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package httpapi_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func TestLookupByTrackIsCached(t *testing.T) {
+	raw := []byte(`{"order_uid":"A","track_number":"WBILMTESTTRACK"}`)
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.LookupOrderUIDFunc = func(ctx context.Context, key repo.LookupKey, value string) (string, error) {
+		if key != repo.LookupTrackNumber || value != "WBILMTESTTRACK" {
+			t.Fatalf("unexpected lookup %s=%s", key, value)
+		}
+		return "A", nil
+	}
+	repoMock.GetOrderRawFunc = func(ctx context.Context, id string) (repo.StoredOrder, error) {
+		return repo.StoredOrder{Raw: raw}, nil
+	}
+	handler := httpapi.DefaultRole(httpapi.NewHandler(repoMock, cache.New(10)), pii.RolePrivileged)
+
+	for i, want := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/by-track/WBILMTESTTRACK", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != string(raw) {
+			t.Fatalf("request %d: %d %s", i+1, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("X-Cache"); got != want {
+			t.Fatalf("request %d: expected X-Cache=%s, got %s", i+1, want, got)
+		}
+	}
+	if n, m := len(repoMock.LookupOrderUIDCalls()), len(repoMock.GetOrderRawCalls()); n != 1 || m != 1 {
+		t.Fatalf("expected one lookup and one load, got %d and %d", n, m)
+	}
+}
+
+func TestLookupAliasesStayOutOfOrderCache(t *testing.T) {
+	c := cache.New(10)
+	repoMock := &mocks.RepositoryMock{
+		LookupOrderUIDFunc: func(ctx context.Context, key repo.LookupKey, value string) (string, error) {
+			return "A", nil
+		},
+		GetOrderRawFunc: func(ctx context.Context, id string) (repo.StoredOrder, error) {
+			if id != "A" {
+				return repo.StoredOrder{}, repo.ErrNotFound
+			}
+			return repo.StoredOrder{Raw: []byte(`{"order_uid":"A","track_number":"T"}`)}, nil
+		},
+	}
+	handler := httpapi.DefaultRole(httpapi.NewHandler(repoMock, c), pii.RolePrivileged)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/by-track/T", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("lookup: %d %s", rec.Code, rec.Body)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("expected only the order in the cache, got %d entries", c.Len())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/by-track:T", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("alias served as an order: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLookupByRIDDropsStaleAlias(t *testing.T) {
+	c := cache.New(10)
+	owner := "A"
+	handler := httpapi.DefaultRole(httpapi.NewHandler(&mocks.RepositoryMock{
+		LookupOrderUIDFunc: func(ctx context.Context, key repo.LookupKey, value string) (string, error) {
+			return owner, nil
+		},
+		GetOrderRawFunc: func(ctx context.Context, id string) (repo.StoredOrder, error) {
+			return repo.StoredOrder{Raw: []byte(fmt.Sprintf(`{"order_uid":%q,"items":[{"rid":"R1"}]}`, id))}, nil
+		},
+	}, c), pii.RolePrivileged)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/by-rid/R1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first lookup: %d %s", rec.Code, rec.Body)
+	}
+
+	// The cached alias points to order A, which no longer has the item.
+	owner = "B"
+	c.Set("A", []byte(`{"order_uid":"A","items":[{"rid":"R2"}]}`))
+
+	for i := 0; i < 2; i++ {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/by-rid/R1", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"order_uid":"B","items":[{"rid":"R1"}]}` {
+			t.Fatalf("request %d: unexpected response: %d %s", i+1, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestLookupByTransactionNotFound(t *testing.T) {
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.LookupOrderUIDFunc = func(ctx context.Context, key repo.LookupKey, value string) (string, error) {
+		return "", fmt.Errorf("transaction %s: %w", value, repo.ErrNotFound)
+	}
+	rec := httptest.NewRecorder()
+	httpapi.NewHandler(repoMock, cache.New(10)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/by-transaction/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
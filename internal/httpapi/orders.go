@@ -0,0 +1,143 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+	"github.com/kosovrzn/wb-tech-l0/internal/view"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type orderList struct {
+	Orders     []json.RawMessage `json:"orders"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// listOrders serves GET /orders: filtered orders, newest first, a page at a
+// time. The next page is requested with the next_cursor of the previous one
+// and the same filters.
+func listOrders(store repo.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f, err := parseOrderFilter(q)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		p, err := projection(r)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		limit := defaultPageSize
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxPageSize {
+				WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+				return
+			}
+			limit = n
+		}
+		var after *repo.OrderCursor
+		if v := q.Get("cursor"); v != "" {
+			c, err := decodeCursor(v)
+			if err != nil {
+				WriteError(w, r, http.StatusBadRequest, "invalid cursor")
+				return
+			}
+			after = &c
+		}
+
+		if err := charge(r.Context(), classMiss); err != nil {
+			writeStoreError(w, r, "list orders", err)
+			return
+		}
+		page, err := store.ListOrders(r.Context(), f, after, limit)
+		if err != nil {
+			writeStoreError(w, r, "list orders", err)
+			return
+		}
+
+		role := callerRole(r)
+		out := orderList{Orders: make([]json.RawMessage, len(page.Orders))}
+		for i, raw := range page.Orders {
+			if raw, err = view.Render(raw, p, role); err != nil {
+				log.Printf("render order: %v", err)
+				WriteError(w, r, http.StatusInternalServerError, "internal error")
+				return
+			}
+			out.Orders[i] = raw
+		}
+		if page.Next != nil {
+			out.NextCursor = encodeCursor(*page.Next)
+		}
+		setPrivate(w.Header())
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+func parseOrderFilter(q url.Values) (repo.OrderFilter, error) {
+	f := repo.OrderFilter{
+		CustomerID:      q.Get("customer_id"),
+		TrackNumber:     q.Get("track_number"),
+		DeliveryService: q.Get("delivery_service"),
+		Entry:           q.Get("entry"),
+		Locale:          q.Get("locale"),
+		Currency:        q.Get("currency"),
+		Provider:        q.Get("provider"),
+		Bank:            q.Get("bank"),
+		Brand:           q.Get("brand"),
+	}
+	var err error
+	if v := q.Get("created_from"); v != "" {
+		if f.CreatedFrom, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("created_from must be an RFC3339 timestamp")
+		}
+	}
+	if v := q.Get("created_to"); v != "" {
+		if f.CreatedTo, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("created_to must be an RFC3339 timestamp")
+		}
+	}
+	if v := q.Get("nm_id"); v != "" {
+		if f.NmID, err = strconv.ParseInt(v, 10, 64); err != nil || f.NmID <= 0 {
+			return f, errors.New("nm_id must be a positive integer")
+		}
+	}
+	return f, nil
+}
+
+// encodeCursor makes an opaque page token of c.
+func encodeCursor(c repo.OrderCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.DateCreated.UTC().Format(time.RFC3339Nano) + "|" + c.OrderUID))
+}
+
+func decodeCursor(s string) (repo.OrderCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return repo.OrderCursor{}, err
+	}
+	ts, uid, ok := strings.Cut(string(b), "|")
+	if !ok || uid == "" {
+		return repo.OrderCursor{}, errors.New("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return repo.OrderCursor{}, err
+	}
+	return repo.OrderCursor{DateCreated: t, OrderUID: uid}, nil
+}
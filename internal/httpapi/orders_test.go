@@ -0,0 +1,85 @@
+package httpapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func TestListOrdersPassesFiltersAndCursor(t *testing.T) {
+	last := repo.OrderCursor{DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 123000000, time.UTC), OrderUID: "B"}
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.ListOrdersFunc = func(ctx context.Context, f repo.OrderFilter, after *repo.OrderCursor, limit int) (repo.OrderPage, error) {
+		if after == nil {
+			return repo.OrderPage{Orders: [][]byte{[]byte(`{"order_uid":"A"}`), []byte(`{"order_uid":"B"}`)}, Next: &last}, nil
+		}
+		return repo.OrderPage{Orders: [][]byte{[]byte(`{"order_uid":"C"}`)}}, nil
+	}
+	handler := httpapi.NewHandler(repoMock, &mocks.StoreMock{})
+
+	q := url.Values{
+		"customer_id":  {"test"},
+		"currency":     {"USD"},
+		"brand":        {"Vivienne Sabo"},
+		"nm_id":        {"2389212"},
+		"created_from": {"2021-11-01T00:00:00Z"},
+		"limit":        {"2"},
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?"+q.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Orders     []json.RawMessage `json:"orders"`
+		NextCursor string            `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Orders) != 2 || page.NextCursor == "" {
+		t.Fatalf("unexpected page: %s", rec.Body)
+	}
+	if rec.Header().Get("Cache-Control") != "private" {
+		t.Fatalf("expected Cache-Control: private on a role-dependent body")
+	}
+
+	q.Set("cursor", page.NextCursor)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?"+q.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	calls := repoMock.ListOrdersCalls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	f := calls[0].F
+	if f.CustomerID != "test" || f.Currency != "USD" || f.Brand != "Vivienne Sabo" || f.NmID != 2389212 ||
+		!f.CreatedFrom.Equal(time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)) || calls[0].Limit != 2 {
+		t.Fatalf("unexpected filter: %+v limit=%d", f, calls[0].Limit)
+	}
+	if after := calls[1].After; after == nil || !after.DateCreated.Equal(last.DateCreated) || after.OrderUID != last.OrderUID {
+		t.Fatalf("cursor not round-tripped: %+v", after)
+	}
+}
+
+func TestListOrdersRejectsInvalidParameters(t *testing.T) {
+	handler := httpapi.NewHandler(&mocks.RepositoryMock{}, &mocks.StoreMock{})
+	for _, q := range []string{"limit=0", "limit=501", "nm_id=x", "created_to=yesterday", "cursor=bm90LWEtY3Vyc29y"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/view"
+)
+
+// projection returns the projection asked for by the fields or view query
+// parameter, or nil for the whole order.
+func projection(r *http.Request) (*view.Projection, error) {
+	q := r.URL.Query()
+	fields, name := q.Get("fields"), q.Get("view")
+	switch {
+	case fields != "" && name != "":
+		return nil, errors.New("fields and view are mutually exclusive")
+	case fields != "":
+		return view.Fields(fields)
+	case name != "":
+		return view.Named(name)
+	}
+	return nil, nil
+}
+
+// callerRole returns the role the personal data of orders is masked for.
+// Requests without one, which only reach the handler when it is not wrapped
+// in DefaultRole or RequireScope, get the most restrictive role.
+func callerRole(r *http.Request) pii.Role {
+	if role, ok := pii.FromContext(r.Context()); ok {
+		return role
+	}
+	return pii.RoleAnalytics
+}
+
+// setPrivate keeps shared caches from storing a response whose body depends
+// on the caller's role and serving it to other callers.
+func setPrivate(h http.Header) {
+	h.Set("Cache-Control", "private")
+}
+
+// DefaultRole assigns role to the requests whose caller has none yet.
+func DefaultRole(next http.Handler, role pii.Role) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := pii.FromContext(r.Context()); !ok {
+			r = r.WithContext(pii.NewContext(r.Context(), role))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// render masks the order in e for role and applies p to it. The result is a
+// representation of its own with its own ETag, kept as a rendition of e so
+// it is rendered and compressed once for as long as e is cached.
+func render(e *cache.Entry, p *view.Projection, role pii.Role) (*cache.Entry, error) {
+	if p == nil && role == pii.RolePrivileged {
+		return e, nil
+	}
+	key := string(role)
+	if p != nil {
+		key += "?" + p.String()
+	}
+	return e.Rendition(key, func(body []byte) ([]byte, error) {
+		return view.Render(body, p, role)
+	})
+}
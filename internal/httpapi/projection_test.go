@@ -0,0 +1,159 @@
+package httpapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func TestOrderHandlerProjectsFromCache(t *testing.T) {
+	h, c := conditionalHandler([]byte(`{"order_uid":"A","delivery":{"city":"Moscow","phone":"+7"},"locale":"ru"}`))
+
+	full := get(h)
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/order/A?fields=order_uid,delivery.city", nil))
+	if first.Code != http.StatusOK || first.Body.String() != `{"delivery":{"city":"Moscow"},"order_uid":"A"}` {
+		t.Fatalf("unexpected response: %d %s", first.Code, first.Body)
+	}
+	if got := first.Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("expected a cache hit, got %s", got)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" || etag == full.Header().Get("ETag") {
+		t.Fatalf("projection must have an ETag of its own, got %q", etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/order/A?fields=order_uid,delivery.city", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+
+	if e, _ := c.GetEntry("A"); e == nil || e.ETag != full.Header().Get("ETag") {
+		t.Fatal("projection replaced the cached order")
+	}
+}
+
+func TestOrderHandlerRejectsBadProjection(t *testing.T) {
+	// The repository mock has no funcs: a bad projection must fail before
+	// the order is loaded.
+	h := httpapi.NewHandler(&mocks.RepositoryMock{}, cache.New(10))
+	for _, target := range []string{
+		"/order/A?fields=nope",
+		"/order/A?view=nope",
+		"/order/A?view=summary&fields=order_uid",
+		"/orders/by-track/T?fields=delivery.nope",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestOrderHandlerMasksPIIForRole(t *testing.T) {
+	raw := []byte(`{"order_uid":"A","delivery":{"name":"Test Testov","phone":"+9720000000","city":"Moscow","email":"test@gmail.com"},"payment":{"transaction":"b563feb7b2b84b6test"}}`)
+	inner, c := conditionalHandler(raw)
+
+	tests := []struct {
+		role pii.Role
+		want string
+	}{
+		{pii.RolePrivileged, string(raw)},
+		{pii.RoleSupport, `{"delivery":{"city":"Moscow","email":"t***@gmail.com","name":"Test T.","phone":"+97*****000"},"payment":{"transaction":"***test"}}`},
+		{pii.RoleAnalytics, `{"delivery":{"city":"Moscow","email":"***","name":"***","phone":"***"},"payment":{"transaction":"***"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			target := "/order/A?fields=delivery.name,delivery.phone,delivery.city,delivery.email,payment.transaction"
+			if tt.role == pii.RolePrivileged {
+				target = "/order/A"
+			}
+			rec := httptest.NewRecorder()
+			httpapi.DefaultRole(inner, tt.role).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+				t.Fatalf("unexpected response: %d %s", rec.Code, rec.Body)
+			}
+		})
+	}
+	if e, _ := c.GetEntry("A"); e == nil || string(e.Body) != string(raw) {
+		t.Fatal("the cache must hold the unmasked order")
+	}
+}
+
+func TestOrderListMasksPII(t *testing.T) {
+	repoMock := &mocks.RepositoryMock{
+		ListOrdersFunc: func(ctx context.Context, f repo.OrderFilter, after *repo.OrderCursor, limit int) (repo.OrderPage, error) {
+			return repo.OrderPage{Orders: [][]byte{[]byte(`{"order_uid":"A","delivery":{"phone":"+9720000000"}}`)}}, nil
+		},
+	}
+	rec := httptest.NewRecorder()
+	httpapi.DefaultRole(httpapi.NewHandler(repoMock, cache.New(10)), pii.RoleAnalytics).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?fields=delivery.phone", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `{"delivery":{"phone":"***"}}`) {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestOrderHandlerRendersOncePerRole(t *testing.T) {
+	raw := []byte(`{"order_uid":"A","delivery":{"phone":"+9720000000"},"items":[` + strings.Repeat(`{"name":"Mascaras","brand":"Vivienne Sabo"},`, 30) + `{}]}`)
+	inner, c := conditionalHandler(raw)
+	h := httpapi.DefaultRole(inner, pii.RoleSupport)
+
+	first := get(h, "Accept-Encoding", "gzip")
+	if first.Code != http.StatusOK || first.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("unexpected response: %d %q", first.Code, first.Header().Get("Content-Encoding"))
+	}
+	if rec := get(h, "Accept-Encoding", "gzip"); rec.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Fatal("the rendition changed between requests")
+	}
+
+	// The masked order and its compressed form live with the cached entry.
+	e, _ := c.GetEntry("A")
+	masked, err := e.Rendition(string(pii.RoleSupport), func([]byte) ([]byte, error) {
+		t.Fatal("support rendition recomputed")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := masked.Encoded("gzip", func([]byte) ([]byte, error) {
+		t.Fatal("gzip recomputed")
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(masked.Body), "+9720000000") {
+		t.Fatalf("rendition is not masked: %s", masked.Body)
+	}
+
+	// A new version of the order drops its renditions.
+	c.SetEntry("A", cache.NewEntry([]byte(`{"order_uid":"A","delivery":{"phone":"+9721111111"}}`), updatedAt))
+	if rec := get(h); !strings.Contains(rec.Body.String(), `"phone":"+97*****111"`) {
+		t.Fatalf("stale rendition served: %s", rec.Body)
+	}
+}
+
+func TestOrderHandlerMasksWithoutRole(t *testing.T) {
+	h := httpapi.NewHandler(&mocks.RepositoryMock{
+		GetOrderRawFunc: func(ctx context.Context, id string) (repo.StoredOrder, error) {
+			return repo.StoredOrder{Raw: []byte(`{"order_uid":"A","delivery":{"phone":"+9720000000"}}`)}, nil
+		},
+	}, cache.New(10))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/A", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"phone":"***"`) {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Body)
+	}
+}
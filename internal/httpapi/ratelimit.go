@@ -0,0 +1,320 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/auth"
+)
+
+// Route names RateLimits.Routes are keyed by.
+const (
+	RouteOrder    = "order"     // /order/{id}
+	RouteList     = "list"      // GET /orders
+	RouteBatchGet = "batch_get" // POST /orders:batchGet
+	RouteLookup   = "lookup"    // GET /orders/by-*
+)
+
+var routeNames = []string{RouteOrder, RouteList, RouteBatchGet, RouteLookup}
+
+// Request classes limited apart: a cache hit is cheap, a miss costs a query.
+const (
+	classHit  = "hit"
+	classMiss = "miss"
+)
+
+// sweepInterval is how often full buckets are dropped.
+const sweepInterval = time.Minute
+
+// Limit is a token bucket of Burst tokens refilled at Rate per second. A zero
+// Rate does not limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RouteLimit holds the limits of one route.
+type RouteLimit struct {
+	Hit  Limit
+	Miss Limit
+}
+
+// RateLimits configures a RateLimiter. Routes override Default by route name.
+// AuthFailures limits the failed authentications of each IP.
+type RateLimits struct {
+	Default      RouteLimit
+	Routes       map[string]RouteLimit
+	AuthFailures Limit
+}
+
+func (l RateLimits) limit(route, class string) Limit {
+	rl, ok := l.Routes[route]
+	if !ok {
+		rl = l.Default
+	}
+	if class == classHit {
+		return rl.Hit
+	}
+	return rl.Miss
+}
+
+// RateLimitedError is returned when a request ran out of tokens.
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry in %s", e.RetryAfter)
+}
+
+// RateLimiter keeps a token bucket per route, class and client. Clients are
+// told apart by their principal when authenticated and by IP otherwise.
+type RateLimiter struct {
+	limits RateLimits
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*rate.Limiter
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	route, class, client string
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{limits: limits, now: time.Now, buckets: make(map[bucketKey]*rate.Limiter)}
+}
+
+// take takes a token from the bucket of k. It returns the bucket state for
+// the RateLimit headers and, when empty, how long until the next token.
+func (l *RateLimiter) take(k bucketKey) (lim Limit, remaining int, reset, retry time.Duration) {
+	return l.takeN(k, l.limits.limit(k.route, k.class), 1)
+}
+
+// takeN takes n tokens from the bucket of k, which holds lim; n may be 0 to
+// only look at the bucket.
+func (l *RateLimiter) takeN(k bucketKey, lim Limit, n int) (_ Limit, remaining int, reset, retry time.Duration) {
+	if lim.Rate <= 0 {
+		return lim, 0, 0, 0
+	}
+	burst := max(lim.Burst, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[k]
+	if !ok {
+		b = rate.NewLimiter(rate.Limit(lim.Rate), burst)
+		l.buckets[k] = b
+	}
+
+	tokens := b.TokensAt(now)
+	if tokens < max(float64(n), 1) {
+		retry = seconds((max(float64(n), 1) - tokens) / lim.Rate)
+	} else {
+		b.AllowN(now, n)
+		tokens -= float64(n)
+	}
+	return Limit{Rate: lim.Rate, Burst: burst}, int(tokens), seconds((float64(burst) - tokens) / lim.Rate), retry
+}
+
+// sweep drops the full buckets, which are no different from new ones, so
+// the map only holds recently active clients.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		if b.TokensAt(now) >= float64(b.Burst()) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// seconds rounds s up to whole seconds, as the headers carry them.
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+type quotaKey struct{}
+
+// quota is the rate limiting state of one request.
+type quota struct {
+	l       *RateLimiter
+	route   string
+	client  string
+	h       http.Header
+	mu      sync.Mutex
+	charged map[string]bool
+}
+
+// wrap makes the requests next serves for route chargeable; next charges
+// them by class as it learns whether they hit the cache.
+func (l *RateLimiter) wrap(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := &quota{l: l, route: route, client: clientKey(r), h: w.Header()}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), quotaKey{}, q)))
+	})
+}
+
+// charge takes a token of class from the bucket of the request in ctx and
+// sets the RateLimit headers. A request is charged once per class it used:
+// a lookup that resolves the alias in the database and finds the order in
+// the cache pays one miss and one hit. It returns a *RateLimitedError when
+// the bucket is empty and nil when the request is not rate limited.
+func charge(ctx context.Context, class string) error {
+	q, ok := ctx.Value(quotaKey{}).(*quota)
+	if !ok {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.charged[class] {
+		return nil
+	}
+	if q.charged == nil {
+		q.charged = make(map[string]bool, 2)
+	}
+	q.charged[class] = true
+
+	lim, remaining, reset, retry := q.l.take(bucketKey{route: q.route, class: class, client: q.client})
+	if lim.Rate <= 0 {
+		return nil
+	}
+	q.h.Set("RateLimit-Limit", strconv.Itoa(lim.Burst))
+	q.h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	q.h.Set("RateLimit-Reset", strconv.Itoa(int(reset/time.Second)))
+	q.h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", lim.Burst, int(math.Ceil(float64(lim.Burst)/lim.Rate))))
+	if retry > 0 {
+		return &RateLimitedError{RetryAfter: retry}
+	}
+	return nil
+}
+
+// GuardAuth counts the requests next rejects with 401 against the bucket of
+// failed authentications of their IP and, once the bucket is empty, refuses
+// the IP's requests before next authenticates them, so floods of missing or
+// invalid credentials never reach the key store. It goes outside
+// RequireScope, while wrap goes inside to limit callers by principal.
+func (l *RateLimiter) GuardAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := bucketKey{route: "auth", class: "failure", client: ipKey(r)}
+		if _, _, _, retry := l.takeN(k, l.limits.AuthFailures, 0); retry > 0 {
+			writeRateLimited(w, r, &RateLimitedError{RetryAfter: retry})
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status == http.StatusUnauthorized {
+			l.takeN(k, l.limits.AuthFailures, 1)
+		}
+	})
+}
+
+// clientKey identifies the caller: its principal when authenticated, its
+// IP otherwise. The IP is the peer address; behind a proxy all clients
+// share the proxy's buckets unless it authenticates them.
+func clientKey(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		return p.Method + ":" + p.Subject
+	}
+	return ipKey(r)
+}
+
+// ipKey identifies the caller by its peer address.
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ParseLimit parses "<n>/<s|m|h>": a bucket of n tokens refilled over the
+// period. Empty or "0" does not limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+	n, unit, ok := strings.Cut(s, "/")
+	count, err := strconv.Atoi(n)
+	if !ok || err != nil || count < 1 {
+		return Limit{}, fmt.Errorf("limit %q: want <n>/<s|m|h>", s)
+	}
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("limit %q: unit must be s, m or h", s)
+	}
+	return Limit{Rate: float64(count) / period.Seconds(), Burst: count}, nil
+}
+
+// ParseRouteLimits parses per-route overrides of def, such as
+// "list=miss:2/s;batch_get=hit:20/s,miss:5/s". A class left out keeps its
+// limit from def.
+func ParseRouteLimits(spec string, def RouteLimit) (map[string]RouteLimit, error) {
+	routes := make(map[string]RouteLimit)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		route, classes, ok := strings.Cut(part, "=")
+		route = strings.TrimSpace(route)
+		if !ok || !slices.Contains(routeNames, route) {
+			return nil, fmt.Errorf("route limit %q: want <route>=hit:<limit>,miss:<limit> with route one of %s", part, strings.Join(routeNames, ", "))
+		}
+		rl := def
+		for _, c := range strings.Split(classes, ",") {
+			class, limit, _ := strings.Cut(strings.TrimSpace(c), ":")
+			l, err := ParseLimit(limit)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %w", route, err)
+			}
+			switch class {
+			case classHit:
+				rl.Hit = l
+			case classMiss:
+				rl.Miss = l
+			default:
+				return nil, fmt.Errorf("route %s: unknown class %q, want hit or miss", route, class)
+			}
+		}
+		routes[route] = rl
+	}
+	return routes, nil
+}
+
+// writeRateLimited answers 429 with Retry-After.
+func writeRateLimited(w http.ResponseWriter, r *http.Request, err *RateLimitedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(err.RetryAfter/time.Second)))
+	WriteError(w, r, http.StatusTooManyRequests, err.Error())
+}
+
+// asRateLimited returns err as a *RateLimitedError, if it is one.
+func asRateLimited(err error) (*RateLimitedError, bool) {
+	var limited *RateLimitedError
+	ok := errors.As(err, &limited)
+	return limited, ok
+}
@@ -0,0 +1,147 @@
+package httpapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/auth"
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func limitedHandler(t *testing.T, routes string) (http.Handler, *mocks.RepositoryMock) {
+	t.Helper()
+	def := httpapi.RouteLimit{}
+	var err error
+	if def.Hit, err = httpapi.ParseLimit("3/m"); err != nil {
+		t.Fatal(err)
+	}
+	if def.Miss, err = httpapi.ParseLimit("1/m"); err != nil {
+		t.Fatal(err)
+	}
+	perRoute, err := httpapi.ParseRouteLimits(routes, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoMock := &mocks.RepositoryMock{
+		GetOrderRawFunc: func(ctx context.Context, id string) (repo.StoredOrder, error) {
+			return repo.StoredOrder{Raw: []byte(`{"order_uid":"` + id + `"}`)}, nil
+		},
+	}
+	limiter := httpapi.NewRateLimiter(httpapi.RateLimits{Default: def, Routes: perRoute})
+	return httpapi.NewHandler(repoMock, cache.New(10), httpapi.WithRateLimit(limiter)), repoMock
+}
+
+func getFrom(h http.Handler, target, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitSeparatesHitsAndMisses(t *testing.T) {
+	h, repoMock := limitedHandler(t, "")
+	const client = "10.0.0.1:5000"
+
+	// One miss fills the cache; the next miss is refused before the query.
+	if rec := getFrom(h, "/order/A", client); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("first miss: %d remaining=%q", rec.Code, rec.Header().Get("RateLimit-Remaining"))
+	}
+	rec := getFrom(h, "/order/B", client)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("second miss: %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if n := len(repoMock.GetOrderRawCalls()); n != 1 {
+		t.Fatalf("expected one query, got %d", n)
+	}
+
+	// Hits have a bucket of their own.
+	for i, remaining := range []string{"2", "1", "0"} {
+		rec := getFrom(h, "/order/A", client)
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "3" || rec.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("hit %d: %d limit=%q remaining=%q", i+1, rec.Code, rec.Header().Get("RateLimit-Limit"), rec.Header().Get("RateLimit-Remaining"))
+		}
+	}
+	if rec := getFrom(h, "/order/A", client); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "20" {
+		t.Fatalf("fourth hit: %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Another client has buckets of its own.
+	if rec := getFrom(h, "/order/B", "10.0.0.2:5000"); rec.Code != http.StatusOK {
+		t.Fatalf("other client: %d", rec.Code)
+	}
+}
+
+func TestRateLimitPerRoute(t *testing.T) {
+	h, _ := limitedHandler(t, "order=miss:0")
+	for i := 0; i < 5; i++ {
+		rec := getFrom(h, "/order/X"+string(rune('a'+i)), "10.0.0.1:5000")
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("miss %d: %d limit=%q", i+1, rec.Code, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
+
+func TestRateLimitGuardsAuthentication(t *testing.T) {
+	lookups := 0
+	keys := countingKeys{auth.FileKeys{auth.HashKey("reader"): {Subject: "reader", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeOrdersRead}}}, &lookups}
+	failures, err := httpapi.ParseLimit("2/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := httpapi.NewRateLimiter(httpapi.RateLimits{AuthFailures: failures})
+	h := httpapi.NewHandler(&mocks.RepositoryMock{
+		GetOrderRawFunc: func(ctx context.Context, id string) (repo.StoredOrder, error) {
+			return repo.StoredOrder{Raw: []byte(`{"order_uid":"A"}`)}, nil
+		},
+	}, cache.New(10), httpapi.WithAuth(&auth.Authenticator{Keys: keys}, nil), httpapi.WithRateLimit(limiter))
+	send := func(key, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/order/A", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(auth.HeaderAPIKey, key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := send("guess", "10.0.0.1:5000"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: %d", i+1, code)
+		}
+	}
+	// The IP is refused before its credentials are looked up, even valid ones.
+	for _, key := range []string{"guess", "reader"} {
+		if code := send(key, "10.0.0.1:5000"); code != http.StatusTooManyRequests {
+			t.Fatalf("%s after failures: %d", key, code)
+		}
+	}
+	if lookups != 2 {
+		t.Fatalf("expected 2 key lookups, got %d", lookups)
+	}
+	if code := send("reader", "10.0.0.2:5000"); code != http.StatusOK {
+		t.Fatalf("other IP: %d", code)
+	}
+}
+
+type countingKeys struct {
+	auth.FileKeys
+	n *int
+}
+
+func (k countingKeys) LookupAPIKey(ctx context.Context, hash string) (auth.Principal, error) {
+	*k.n++
+	return k.FileKeys.LookupAPIKey(ctx, hash)
+}
+
+func TestParseRouteLimitsRejectsUnknownRoutes(t *testing.T) {
+	for _, spec := range []string{"orders=hit:1/s", "order=slow:1/s", "order=hit:1/d", "order"} {
+		if _, err := httpapi.ParseRouteLimits(spec, httpapi.RouteLimit{}); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/codec"
 	"github.com/kosovrzn/wb-tech-l0/internal/domain"
 	"github.com/kosovrzn/wb-tech-l0/internal/repo"
 	"github.com/kosovrzn/wb-tech-l0/internal/validation"
@@ -26,109 +29,506 @@ type MessageReader interface {
 	Close() error
 }
 
-func Run(ctx context.Context, brokers, topic, group string, r repo.Repository, c cache.Store) error {
-	if err := ensureTopic(ctx, brokers, topic); err != nil {
+// Config describes the Kafka connection and topics used by the consumer.
+type Config struct {
+	Brokers string
+	Topic   string
+	Group   string
+	// DLQTopic receives messages that can never be processed. Empty disables it.
+	DLQTopic string
+	// QuarantineTopic receives valid orders that could not be stored.
+	// Empty falls back to DLQTopic.
+	QuarantineTopic string
+	Retry           RetryPolicy
+	// Workers is the number of goroutines processing messages in parallel.
+	Workers int
+	// MaxInFlight bounds the number of fetched but not yet processed messages.
+	MaxInFlight int
+	// ShardByKey keeps ordering per message key (order_uid) instead of per partition.
+	ShardByKey bool
+	// BatchSize is the maximum number of messages a worker stores in one transaction.
+	BatchSize int
+	// BatchWait is how long a worker waits for a batch to fill up.
+	BatchWait time.Duration
+	// VersionSource selects where the order version comes from:
+	// VersionFromTimestamp, VersionFromHeader or VersionFromPayload.
+	VersionSource string
+	// Codecs decodes snapshots published in non-JSON formats; nil accepts JSON only.
+	Codecs *codec.Registry
+	// Metrics receives consumer instrumentation; nil disables it.
+	Metrics Metrics
+	// StatsInterval is how often reader stats are passed to Metrics.
+	StatsInterval time.Duration
+	// Security configures SASL and TLS for every broker connection.
+	Security Security
+	// Provisioning controls how Run creates and grows its topics.
+	Provisioning Provisioning
+}
+
+func Run(ctx context.Context, cfg Config, r repo.Repository, c cache.Store) error {
+	conn, err := cfg.Security.connectors()
+	if err != nil {
+		return err
+	}
+	admin := &kafka.Client{Addr: kafka.TCP(strings.Split(cfg.Brokers, ",")...), Timeout: 10 * time.Second, Transport: conn.transport}
+	provision := func(topic string, spec TopicSpec) error {
+		if cfg.Provisioning.Disabled {
+			return nil
+		}
+		return ensureTopic(ctx, admin, topic, spec)
+	}
+	if err := provision(cfg.Topic, cfg.Provisioning.Topic); err != nil {
+		return err
+	}
+
+	if cfg.QuarantineTopic == "" {
+		cfg.QuarantineTopic = cfg.DLQTopic
+	}
+	writers := make(map[string]*kafka.Writer, 2)
+	writerFor := func(topic string) (MessageWriter, error) {
+		if topic == "" {
+			return nil, nil
+		}
+		if w, ok := writers[topic]; ok {
+			return w, nil
+		}
+		if err := provision(topic, cfg.Provisioning.DLQ); err != nil {
+			return nil, err
+		}
+		w := newDLQWriter(cfg.Brokers, topic, conn.transport)
+		writers[topic] = w
+		return w, nil
+	}
+	defer func() {
+		for _, w := range writers {
+			w.Close()
+		}
+	}()
+
+	dlq, err := writerFor(cfg.DLQTopic)
+	if err != nil {
+		return err
+	}
+	quarantine, err := writerFor(cfg.QuarantineTopic)
+	if err != nil {
 		return err
 	}
 
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:               strings.Split(brokers, ","),
-		GroupID:               group,
-		GroupTopics:           []string{topic},
+		Brokers:               strings.Split(cfg.Brokers, ","),
+		GroupID:               cfg.Group,
+		GroupTopics:           []string{cfg.Topic},
 		StartOffset:           kafka.FirstOffset,
 		MinBytes:              1,
 		MaxBytes:              10 << 20,
 		CommitInterval:        0,
 		WatchPartitionChanges: true,
+		Dialer:                conn.dialer,
 		Logger:                log.New(os.Stdout, "[kafka] ", 0),
 		ErrorLogger:           log.New(os.Stderr, "[kafka-err] ", 0),
 	})
 	defer reader.Close()
 
-	log.Printf("consumer START (brokers=%s topic=%s group=%s)", brokers, topic, group)
+	if cfg.Metrics != nil && cfg.StatsInterval > 0 {
+		go reportStats(ctx, reader, cfg.Metrics, cfg.StatsInterval)
+	}
 
-	return consume(ctx, reader, r, c, validation.New())
+	log.Printf("consumer START (brokers=%s security=%s topic=%s group=%s dlq=%s quarantine=%s workers=%d in_flight=%d shard_by_key=%t batch=%d/%s)",
+		cfg.Brokers, cfg.Security, cfg.Topic, cfg.Group, cfg.DLQTopic, cfg.QuarantineTopic, cfg.Workers, cfg.MaxInFlight, cfg.ShardByKey,
+		cfg.BatchSize, cfg.BatchWait)
+
+	return consume(ctx, reader, &processor{
+		repo:        r,
+		cache:       c,
+		validator:   validation.New(),
+		dlq:         dlq,
+		quarantine:  quarantine,
+		retry:       cfg.Retry,
+		workers:     cfg.Workers,
+		maxInFlight: cfg.MaxInFlight,
+		shardByKey:  cfg.ShardByKey,
+		batchSize:   cfg.BatchSize,
+		batchWait:   cfg.BatchWait,
+
+		versionSource: cfg.VersionSource,
+		codecs:        cfg.Codecs,
+		metrics:       cfg.Metrics,
+	})
 }
 
-func consume(ctx context.Context, reader MessageReader, r repo.Repository, c cache.Store, validator *validation.Validator) error {
+// reportStats passes reader.Stats to m every interval until ctx is done.
+func reportStats(ctx context.Context, reader *kafka.Reader, m Metrics, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
 	for {
-		m, err := reader.FetchMessage(ctx)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				return nil
-			}
-			return err
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.ObserveReader(reader.Stats())
 		}
+	}
+}
 
-		var o domain.Order
-		if err := json.Unmarshal(m.Value, &o); err != nil {
-			log.Printf("skip invalid msg: %v", err)
-			_ = reader.CommitMessages(ctx, m)
+// processor holds everything needed to consume and handle messages.
+type processor struct {
+	repo       repo.Repository
+	cache      cache.Store
+	validator  *validation.Validator
+	dlq        MessageWriter
+	quarantine MessageWriter
+	retry      RetryPolicy
+
+	workers     int
+	maxInFlight int
+	shardByKey  bool
+	batchSize   int
+	batchWait   time.Duration
+
+	versionSource string
+	codecs        *codec.Registry
+	metrics       Metrics
+	// force overwrites stored orders regardless of version and ledger.
+	force bool
+
+	applied      atomic.Int64
+	rejected     atomic.Int64
+	staleSkipped atomic.Int64
+	duplicates   atomic.Int64
+}
+
+// decoded is a message that passed parsing and validation. It carries either
+// a full snapshot (order), a partial update (patch) or a tombstone.
+type decoded struct {
+	idx       int
+	msg       kafka.Message
+	order     *domain.Order
+	patch     domain.Patch
+	tombstone bool
+	raw       []byte
+	version   int64
+}
+
+func (d decoded) uid() string {
+	switch {
+	case d.tombstone:
+		return string(d.msg.Key)
+	case d.patch != nil:
+		return d.patch.OrderID()
+	default:
+		return d.order.OrderUID
+	}
+}
+
+func (d decoded) source() *repo.MessageRef {
+	return &repo.MessageRef{Topic: d.msg.Topic, Partition: d.msg.Partition, Offset: d.msg.Offset}
+}
+
+func (d decoded) record(force bool, at time.Time) repo.OrderWithRaw {
+	return repo.OrderWithRaw{
+		Order:     d.order,
+		Raw:       d.raw,
+		Version:   d.version,
+		Source:    d.source(),
+		Force:     force,
+		UpdatedAt: at,
+	}
+}
+
+func (d decoded) deletion(force bool) repo.OrderDeletion {
+	return repo.OrderDeletion{OrderUID: d.uid(), Source: d.source(), Force: force}
+}
+
+func (d decoded) patchRecord(force bool, at time.Time) repo.OrderPatch {
+	return repo.OrderPatch{
+		Patch:     d.patch,
+		Version:   d.version,
+		Source:    d.source(),
+		Force:     force,
+		UpdatedAt: at,
+	}
+}
+
+// handleBatch processes msgs and returns one result per message, in order.
+// Snapshots between partial updates and tombstones are stored as one batch;
+// the others are applied one by one so that their order relative to snapshots holds.
+func (p *processor) handleBatch(ctx context.Context, msgs []kafka.Message) []result {
+	results := make([]result, len(msgs))
+	pending := make([]decoded, 0, len(msgs))
+	for i, m := range msgs {
+		results[i].msg = m
+		d, commit, err := p.decode(ctx, m)
+		if d == nil {
+			results[i].commit, results[i].err = commit, err
 			continue
 		}
-		if err := validator.ValidateOrder(&o); err != nil {
-			oid := o.OrderUID
-			if oid == "" {
-				oid = "<unknown>"
-			}
-			log.Printf("skip semantically invalid msg: order_uid=%s err=%v", oid, err)
-			_ = reader.CommitMessages(ctx, m)
+		d.idx = i
+		if d.order == nil {
+			p.store(ctx, pending, results)
+			pending = pending[:0]
+			results[i].commit, results[i].err = p.storeOne(ctx, *d)
 			continue
 		}
+		pending = append(pending, *d)
+	}
+	p.store(ctx, pending, results)
+	return results
+}
 
-		if err := r.UpsertOrder(ctx, &o, m.Value); err != nil {
-			log.Printf("db upsert failed: %v", err)
-			continue
+// decode parses and validates m. A nil result means m was rejected, in which
+// case commit and err describe the outcome.
+func (p *processor) decode(ctx context.Context, m kafka.Message) (*decoded, bool, error) {
+	if len(m.Value) == 0 && len(m.Key) > 0 {
+		if err := p.validator.ValidateOrderUID(string(m.Key)); err != nil {
+			log.Printf("skip tombstone with invalid key: %v", err)
+			commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidOrder, err)
+			return nil, commit, err
+		}
+		return &decoded{msg: m, tombstone: true}, false, nil
+	}
+
+	ct, _ := headerValue(m, codec.HeaderContentType)
+	c, err := p.codecs.Lookup(ct, m.Value)
+	if err != nil {
+		log.Printf("skip msg in unsupported format: %v", err)
+		commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidPayload, err)
+		return nil, commit, err
+	}
+	if c != nil {
+		var o *domain.Order
+		unavailable := func(err error) bool { return errors.Is(err, codec.ErrRegistryUnavailable) }
+		_, err := p.retry.retry(ctx, unavailable, func() error {
+			var err error
+			o, err = c.Decode(ctx, m.Value)
+			return err
+		})
+		if err != nil && ctx.Err() != nil {
+			return nil, false, nil
+		}
+		if unavailable(err) {
+			// The payload may be fine: stop rather than dead-letter it.
+			return nil, false, fmt.Errorf("decode msg partition=%d offset=%d: %w", m.Partition, m.Offset, err)
 		}
-		c.Set(o.OrderUID, m.Value)
+		if err != nil {
+			log.Printf("skip undecodable msg: %v", err)
+			commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidPayload, err)
+			return nil, commit, err
+		}
+		return p.snapshot(ctx, m, o, 0)
+	}
 
-		if err := reader.CommitMessages(ctx, m); err != nil {
-			log.Printf("commit failed: %v", err)
+	ev, err := parseEvent(m)
+	if err != nil {
+		log.Printf("skip invalid msg: %v", err)
+		commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidJSON, err)
+		return nil, commit, err
+	}
+
+	if ev.typ == domain.EventSnapshot {
+		payload, err := upcastSnapshot(m, ev.payload)
+		if err != nil {
+			log.Printf("skip msg of unsupported schema: %v", err)
+			commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidPayload, err)
+			return nil, commit, err
 		}
+		var o domain.Order
+		if err := json.Unmarshal(payload, &o); err != nil {
+			log.Printf("skip invalid msg: %v", err)
+			commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidJSON, err)
+			return nil, commit, err
+		}
+		return p.snapshot(ctx, m, &o, ev.version)
+	}
+
+	patch := domain.NewPatch(ev.typ)
+	if patch == nil {
+		log.Printf("skip msg of unknown event type %q", ev.typ)
+		commit, err := p.reject(ctx, p.dlq, m, ReasonUnknownEvent, fmt.Errorf("unknown event type %q", ev.typ))
+		return nil, commit, err
 	}
+	if err := json.Unmarshal(ev.payload, patch); err != nil {
+		log.Printf("skip invalid %s msg: %v", ev.typ, err)
+		commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidJSON, err)
+		return nil, commit, err
+	}
+	if err := p.validator.ValidatePatch(patch); err != nil {
+		log.Printf("skip semantically invalid %s msg: order_uid=%s err=%v", ev.typ, patch.OrderID(), err)
+		commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidOrder, err)
+		return nil, commit, err
+	}
+	return &decoded{msg: m, patch: patch, version: orderVersion(p.versionSource, m, ev.version)}, false, nil
 }
 
-func ensureTopic(ctx context.Context, brokers, topic string) error {
-	list := strings.Split(brokers, ",")
-	if len(list) == 0 {
-		return errors.New("no kafka brokers configured")
+// snapshot validates a decoded full order and prepares it for storing with
+// its canonical JSON. version is the envelope version, zero when absent.
+func (p *processor) snapshot(ctx context.Context, m kafka.Message, o *domain.Order, version int64) (*decoded, bool, error) {
+	if err := p.validator.ValidateOrder(o); err != nil {
+		oid := o.OrderUID
+		if oid == "" {
+			oid = "<unknown>"
+		}
+		log.Printf("skip semantically invalid msg: order_uid=%s err=%v", oid, err)
+		commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidOrder, err)
+		return nil, commit, err
+	}
+	raw, err := codec.Canonical(o)
+	if err != nil {
+		commit, err := p.reject(ctx, p.dlq, m, ReasonInvalidOrder, err)
+		return nil, commit, err
 	}
+	if version == 0 {
+		version = o.Version
+	}
+	return &decoded{msg: m, order: o, raw: raw, version: orderVersion(p.versionSource, m, version)}, false, nil
+}
 
-	retryCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+// store writes items in one transaction. When the batch fails for good it is
+// split in halves until the offending record is isolated and quarantined on
+// its own. A failure that outlasted the retries, such as an outage, says
+// nothing about the records and stops the consumer without committing them.
+func (p *processor) store(ctx context.Context, items []decoded, results []result) {
+	switch len(items) {
+	case 0:
+		return
+	case 1:
+		it := items[0]
+		results[it.idx].commit, results[it.idx].err = p.storeOne(ctx, it)
+		return
+	}
 
-	var lastErr error
-	for {
-		select {
-		case <-retryCtx.Done():
-			if lastErr == nil {
-				lastErr = retryCtx.Err()
-			}
-			return lastErr
+	at := writeTime()
+	batch := make([]repo.OrderWithRaw, len(items))
+	for i, it := range items {
+		batch[i] = it.record(p.force, at)
+	}
+	var statuses []repo.UpsertStatus
+	_, err := p.retry.retry(ctx, repo.IsRetryable, func() error {
+		defer p.observeUpsert("batch", time.Now())
+		var err error
+		statuses, err = p.repo.UpsertOrders(ctx, batch)
+		return err
+	})
+	if err == nil {
+		for i, it := range items {
+			p.stored(it, statuses[i], it.raw, at)
+			results[it.idx].commit = true
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if repo.IsRetryable(err) {
+		p.metrics.UpsertFailed()
+		log.Printf("batch upsert of %d orders failed, stopping: %v", len(items), err)
+		err = fmt.Errorf("upsert batch of %d orders: %w", len(items), err)
+		for _, it := range items {
+			results[it.idx].err = err
+		}
+		return
+	}
+
+	log.Printf("batch upsert of %d orders failed, splitting: %v", len(items), err)
+	mid := len(items) / 2
+	p.store(ctx, items[:mid], results)
+	p.store(ctx, items[mid:], results)
+}
+
+func (p *processor) storeOne(ctx context.Context, it decoded) (bool, error) {
+	m := it.msg
+	var status repo.UpsertStatus
+	raw := it.raw
+	at := writeTime()
+	attempts, err := p.retry.retry(ctx, repo.IsRetryable, func() error {
+		var err error
+		switch {
+		case it.tombstone:
+			defer p.observeUpsert("delete", time.Now())
+			status, err = p.repo.DeleteOrder(ctx, it.deletion(p.force))
+		case it.patch != nil:
+			defer p.observeUpsert("patch", time.Now())
+			status, raw, err = p.repo.ApplyPatch(ctx, it.patchRecord(p.force, at))
 		default:
+			defer p.observeUpsert("order", time.Now())
+			status, err = p.repo.UpsertOrder(ctx, it.record(p.force, at))
 		}
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		if errors.Is(err, repo.ErrInvalidOrder) {
+			// The patch itself is bad, like an invalid snapshot.
+			log.Printf("skip patch that would invalidate the order: partition=%d offset=%d err=%v", m.Partition, m.Offset, err)
+			return p.reject(ctx, p.dlq, m, ReasonInvalidOrder, err)
+		}
+		p.metrics.UpsertFailed()
+		log.Printf("db upsert failed: order_uid=%s attempts=%d retryable=%t err=%v",
+			it.uid(), attempts, repo.IsRetryable(err), err)
+		if p.quarantine == nil {
+			// Without a quarantine topic an outage stops the consumer rather
+			// than dropping orders; a message the database refuses for good
+			// is dropped and counted like an invalid one without a DLQ.
+			if repo.IsRetryable(err) {
+				return false, fmt.Errorf("upsert order %s: no quarantine topic configured: %w", it.uid(), err)
+			}
+			log.Printf("drop order that cannot be stored, no quarantine topic configured: order_uid=%s partition=%d offset=%d",
+				it.uid(), m.Partition, m.Offset)
+		}
+		return p.reject(ctx, p.quarantine, m, ReasonUpsertFailed, err, attemptsHeader(attempts))
+	}
+	p.stored(it, status, raw, at)
+	return true, nil
+}
 
-		conn, err := kafka.DialContext(retryCtx, "tcp", list[0])
-		if err != nil {
-			lastErr = err
-			time.Sleep(500 * time.Millisecond)
-			continue
+// stored caches raw, the stored JSON of the order, with at, its stored
+// updated_at, after a write that applied (or drops the order after a delete)
+// and counts the ones skipped because a newer version was already stored or
+// the message was already processed.
+func (p *processor) stored(it decoded, status repo.UpsertStatus, raw []byte, at time.Time) {
+	switch status {
+	case repo.Stale:
+		n := p.staleSkipped.Add(1)
+		log.Printf("skip stale order: order_uid=%s version=%d (skipped total=%d)", it.uid(), it.version, n)
+	case repo.Duplicate:
+		n := p.duplicates.Add(1)
+		log.Printf("skip already processed msg: order_uid=%s partition=%d offset=%d (skipped total=%d)",
+			it.uid(), it.msg.Partition, it.msg.Offset, n)
+	default:
+		p.applied.Add(1)
+		if it.tombstone {
+			p.cache.Delete(it.uid())
+			log.Printf("order deleted: order_uid=%s", it.uid())
+			return
 		}
+		p.cache.SetEntry(it.uid(), cache.NewEntry(raw, at))
+	}
+}
 
-		err = conn.CreateTopics(kafka.TopicConfig{
-			Topic:             topic,
-			NumPartitions:     1,
-			ReplicationFactor: 1,
-		})
-		conn.Close()
-		if err != nil {
-			if errors.Is(err, kafka.TopicAlreadyExists) {
-				return nil
-			}
-			lastErr = err
-			time.Sleep(500 * time.Millisecond)
-			continue
+// writeTime is the updated_at a write stores and the cache serves as
+// Last-Modified, at the precision Postgres keeps.
+func writeTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// reject publishes m to w, retrying with the processor's policy. Failing to
+// park a message is fatal: committing it anyway would lose the payload.
+func (p *processor) reject(ctx context.Context, w MessageWriter, m kafka.Message, reason string, cause error, extra ...kafka.Header) (bool, error) {
+	_, err := p.retry.retry(ctx, func(error) bool { return true }, func() error {
+		return deadLetter(ctx, w, m, reason, cause, extra...)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, nil
 		}
-		return nil
+		return false, fmt.Errorf("publish %s message (partition=%d offset=%d): %w", reason, m.Partition, m.Offset, err)
 	}
+	p.rejected.Add(1)
+	p.metrics.MessageSkipped(reason)
+	return true, nil
+}
+
+func (p *processor) observeUpsert(kind string, start time.Time) {
+	p.metrics.ObserveUpsert(kind, time.Since(start))
 }
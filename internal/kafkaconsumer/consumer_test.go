@@ -2,13 +2,19 @@ package kafkaconsumer
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/segmentio/kafka-go"
 
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
 	"github.com/kosovrzn/wb-tech-l0/internal/domain"
 	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
 	"github.com/kosovrzn/wb-tech-l0/internal/validation"
 )
 
@@ -83,29 +89,37 @@ func TestConsume_ProcessesValidMessage(t *testing.T) {
 	}
 	readerMock.CloseFunc = func() error { return nil }
 
-	upsertCalled := false
+	var updatedAt time.Time
 	repoMock := &mocks.RepositoryMock{}
-	repoMock.UpsertOrderFunc = func(context.Context, *domain.Order, []byte) error {
-		upsertCalled = true
-		return nil
+	repoMock.UpsertOrderFunc = func(_ context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		updatedAt = rec.UpdatedAt
+		return repo.Applied, nil
 	}
 
-	cacheStored := false
+	var cached *cache.Entry
 	cacheMock := &mocks.StoreMock{
 		GetFunc: func(string) ([]byte, bool) { return nil, false },
-		SetFunc: func(id string, _ []byte) { cacheStored = (id == "ORDER1") },
+		SetEntryFunc: func(id string, e *cache.Entry) {
+			if id == "ORDER1" {
+				cached = e
+			}
+		},
 	}
 
-	err := consume(ctx, readerMock, repoMock, cacheMock, validation.New())
+	err := consume(ctx, readerMock, &processor{repo: repoMock, cache: cacheMock, validator: validation.New()})
 	if err != nil {
 		t.Fatalf("consume returned error: %v", err)
 	}
-	if !upsertCalled {
-		t.Fatalf("expected upsert to be called")
+	if updatedAt.IsZero() {
+		t.Fatalf("expected upsert with updated_at to be called")
 	}
-	if !cacheStored {
+	if cached == nil {
 		t.Fatalf("expected cache to store value")
 	}
+	// Last-Modified served from the cache is the stored updated_at.
+	if !cached.LastModified.Equal(updatedAt.Truncate(time.Second)) {
+		t.Fatalf("expected Last-Modified %v, got %v", updatedAt, cached.LastModified)
+	}
 	if !commitCalled {
 		t.Fatalf("expected commit to be called")
 	}
@@ -177,19 +191,41 @@ func TestConsume_DoesNotCommitOnUpsertError(t *testing.T) {
 	readerMock.CloseFunc = func() error { return nil }
 
 	repoMock := &mocks.RepositoryMock{}
-	repoMock.UpsertOrderFunc = func(context.Context, *domain.Order, []byte) error {
-		return errors.New("db error")
+	repoMock.UpsertOrderFunc = func(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		return 0, &pgconn.PgError{Code: "08006"}
 	}
 
 	cacheMock := &mocks.StoreMock{
-		GetFunc: func(string) ([]byte, bool) { return nil, false },
-		SetFunc: func(string, []byte) { t.Fatalf("cache should not be set when upsert fails") },
+		GetFunc:      func(string) ([]byte, bool) { return nil, false },
+		SetEntryFunc: func(string, *cache.Entry) { t.Fatalf("cache should not be set when upsert fails") },
 	}
 
-	err := consume(ctx, readerMock, repoMock, cacheMock, validation.New())
-	if err != nil {
+	err := consume(ctx, readerMock, &processor{repo: repoMock, cache: cacheMock, validator: validation.New()})
+	if err == nil {
+		t.Fatalf("expected consume to stop when upsert fails without a quarantine topic")
+	}
+}
+
+func TestConsume_DropsPermanentUpsertErrorWithoutQuarantine(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{Value: orderJSON(t, "ORDER4")})
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		return 0, fmt.Errorf("orders upsert: %w", &pgconn.PgError{Code: "23514"})
+	}
+	p := &processor{
+		repo:      repoMock,
+		cache:     &mocks.StoreMock{},
+		validator: validation.New(),
+		retry:     testRetryPolicy(5),
+	}
+	if err := consume(context.Background(), readerMock, p); err != nil {
 		t.Fatalf("consume returned error: %v", err)
 	}
+	if len(readerMock.CommitMessagesCalls()) != 1 || p.rejected.Load() != 1 {
+		t.Fatalf("expected the message to be committed and counted, commits=%d rejected=%d",
+			len(readerMock.CommitMessagesCalls()), p.rejected.Load())
+	}
 }
 
 func TestConsume_CommitsInvalidMessage(t *testing.T) {
@@ -214,17 +250,17 @@ func TestConsume_CommitsInvalidMessage(t *testing.T) {
 	readerMock.CloseFunc = func() error { return nil }
 
 	repoMock := &mocks.RepositoryMock{}
-	repoMock.UpsertOrderFunc = func(context.Context, *domain.Order, []byte) error {
+	repoMock.UpsertOrderFunc = func(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
 		t.Fatalf("upsert should not be called on invalid JSON")
-		return nil
+		return 0, nil
 	}
 
 	cacheMock := &mocks.StoreMock{
-		GetFunc: func(string) ([]byte, bool) { return nil, false },
-		SetFunc: func(string, []byte) { t.Fatalf("cache should not be set on invalid message") },
+		GetFunc:      func(string) ([]byte, bool) { return nil, false },
+		SetEntryFunc: func(string, *cache.Entry) { t.Fatalf("cache should not be set on invalid message") },
 	}
 
-	err := consume(ctx, readerMock, repoMock, cacheMock, validation.New())
+	err := consume(ctx, readerMock, &processor{repo: repoMock, cache: cacheMock, validator: validation.New()})
 	if err != nil {
 		t.Fatalf("consume returned error: %v", err)
 	}
@@ -232,3 +268,428 @@ func TestConsume_CommitsInvalidMessage(t *testing.T) {
 		t.Fatalf("expected commit to be called once, got %d", commitCount)
 	}
 }
+
+func TestConsume_PublishesInvalidMessageToDLQ(t *testing.T) {
+	ctx := context.Background()
+
+	src := kafka.Message{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("k1"),
+		Value:     []byte("invalid json"),
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	messages := []kafka.Message{src}
+
+	readerMock := &mocks.MessageReaderMock{}
+	readerMock.FetchMessageFunc = func(context.Context) (kafka.Message, error) {
+		if len(messages) == 0 {
+			return kafka.Message{}, context.Canceled
+		}
+		m := messages[0]
+		messages = messages[1:]
+		return m, nil
+	}
+	readerMock.CommitMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+
+	var published []kafka.Message
+	dlqMock := &mocks.MessageWriterMock{}
+	dlqMock.WriteMessagesFunc = func(_ context.Context, msgs ...kafka.Message) error {
+		published = append(published, msgs...)
+		return nil
+	}
+
+	err := consume(ctx, readerMock, &processor{
+		repo:      &mocks.RepositoryMock{},
+		cache:     &mocks.StoreMock{},
+		validator: validation.New(),
+		dlq:       dlqMock,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if len(published) != 1 {
+		t.Fatalf("expected 1 dead-lettered message, got %d", len(published))
+	}
+	got := published[0]
+	if string(got.Value) != "invalid json" || string(got.Key) != "k1" {
+		t.Fatalf("expected original key/value, got key=%q value=%q", got.Key, got.Value)
+	}
+
+	want := map[string]string{
+		HeaderDLQReason:       ReasonInvalidJSON,
+		HeaderSourceTopic:     "orders",
+		HeaderSourcePartition: "3",
+		HeaderSourceOffset:    "42",
+		HeaderSourceTimestamp: "2024-01-02T03:04:05Z",
+	}
+	headers := make(map[string]string, len(got.Headers))
+	for _, h := range got.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	for k, v := range want {
+		if headers[k] != v {
+			t.Fatalf("header %s: expected %q, got %q", k, v, headers[k])
+		}
+	}
+	if headers[HeaderDLQError] == "" {
+		t.Fatalf("expected %s header to be set", HeaderDLQError)
+	}
+	if len(readerMock.CommitMessagesCalls()) != 1 {
+		t.Fatalf("expected source message to be committed after dead-lettering")
+	}
+}
+
+func TestConsume_DoesNotCommitWhenDLQFails(t *testing.T) {
+	ctx := context.Background()
+
+	messages := []kafka.Message{{Value: []byte(`{"order_uid":"bad"}`)}}
+
+	readerMock := &mocks.MessageReaderMock{}
+	readerMock.FetchMessageFunc = func(context.Context) (kafka.Message, error) {
+		if len(messages) == 0 {
+			return kafka.Message{}, context.Canceled
+		}
+		m := messages[0]
+		messages = messages[1:]
+		return m, nil
+	}
+	readerMock.CommitMessagesFunc = func(context.Context, ...kafka.Message) error {
+		t.Fatalf("commit should not be called when dead-letter publish fails")
+		return nil
+	}
+
+	dlqMock := &mocks.MessageWriterMock{}
+	dlqMock.WriteMessagesFunc = func(_ context.Context, msgs ...kafka.Message) error {
+		for _, h := range msgs[0].Headers {
+			if h.Key == HeaderDLQReason && string(h.Value) != ReasonInvalidOrder {
+				t.Fatalf("expected reason %s, got %s", ReasonInvalidOrder, h.Value)
+			}
+		}
+		return errors.New("broker unavailable")
+	}
+
+	err := consume(ctx, readerMock, &processor{
+		repo:      &mocks.RepositoryMock{},
+		cache:     &mocks.StoreMock{},
+		validator: validation.New(),
+		dlq:       dlqMock,
+	})
+	if err == nil {
+		t.Fatalf("expected consume to stop when the dead-letter topic is unavailable")
+	}
+	if len(dlqMock.WriteMessagesCalls()) != 1 {
+		t.Fatalf("expected one dead-letter attempt")
+	}
+}
+
+func TestConsume_RetriesTransientUpsertError(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{Value: orderJSON(t, "ORDER3")})
+
+	calls := 0
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		calls++
+		if calls == 1 {
+			return 0, &pgconn.PgError{Code: "40001"}
+		}
+		return repo.Applied, nil
+	}
+	cacheMock := &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      repoMock,
+		cache:     cacheMock,
+		validator: validation.New(),
+		retry:     testRetryPolicy(3),
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 upsert attempts, got %d", calls)
+	}
+	if len(cacheMock.SetEntryCalls()) != 1 {
+		t.Fatalf("expected cache to be updated after successful retry")
+	}
+	if len(readerMock.CommitMessagesCalls()) != 1 {
+		t.Fatalf("expected message to be committed after successful retry")
+	}
+}
+
+func TestConsume_QuarantinesPermanentUpsertError(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{Value: orderJSON(t, "ORDER4")})
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		return 0, fmt.Errorf("orders upsert: %w", &pgconn.PgError{Code: "23505"})
+	}
+	quarantineMock := &mocks.MessageWriterMock{}
+	quarantineMock.WriteMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:       repoMock,
+		cache:      &mocks.StoreMock{},
+		validator:  validation.New(),
+		quarantine: quarantineMock,
+		retry:      testRetryPolicy(5),
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if n := len(repoMock.UpsertOrderCalls()); n != 1 {
+		t.Fatalf("permanent errors must not be retried, got %d attempts", n)
+	}
+	assertQuarantined(t, quarantineMock, "1")
+	if len(readerMock.CommitMessagesCalls()) != 1 {
+		t.Fatalf("expected quarantined message to be committed")
+	}
+}
+
+func TestConsume_QuarantinesWhenRetriesExhausted(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{Value: orderJSON(t, "ORDER5")})
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		return 0, &pgconn.PgError{Code: "40P01"}
+	}
+	quarantineMock := &mocks.MessageWriterMock{}
+	quarantineMock.WriteMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:       repoMock,
+		cache:      &mocks.StoreMock{},
+		validator:  validation.New(),
+		quarantine: quarantineMock,
+		retry:      testRetryPolicy(3),
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if n := len(repoMock.UpsertOrderCalls()); n != 3 {
+		t.Fatalf("expected 3 upsert attempts, got %d", n)
+	}
+	assertQuarantined(t, quarantineMock, "3")
+}
+
+func newReaderMock(msgs ...kafka.Message) *mocks.MessageReaderMock {
+	return &mocks.MessageReaderMock{
+		FetchMessageFunc: func(context.Context) (kafka.Message, error) {
+			if len(msgs) == 0 {
+				return kafka.Message{}, context.Canceled
+			}
+			m := msgs[0]
+			msgs = msgs[1:]
+			return m, nil
+		},
+		CommitMessagesFunc: func(context.Context, ...kafka.Message) error { return nil },
+		CloseFunc:          func() error { return nil },
+	}
+}
+
+func orderJSON(t *testing.T, uid string) []byte {
+	t.Helper()
+	o := domain.Order{
+		OrderUID:    uid,
+		TrackNumber: "TRACK" + uid,
+		Entry:       "WBIL",
+		Delivery: domain.Delivery{
+			Name:    "John Doe",
+			Phone:   "+10000000000",
+			Zip:     "123456",
+			City:    "City",
+			Address: "Street 1",
+			Region:  "Region",
+			Email:   "john@example.com",
+		},
+		Payment: domain.Payment{
+			Transaction: "TXN" + uid,
+			Currency:    "USD",
+			Provider:    "wbpay",
+			Amount:      100,
+			PaymentDT:   1637907727,
+			Bank:        "alpha",
+			GoodsTotal:  100,
+		},
+		Items: []domain.Item{{
+			ChrtID:      1,
+			TrackNumber: "TRACK" + uid,
+			Price:       100,
+			RID:         "RID" + uid,
+			Name:        "Item",
+			Size:        "M",
+			TotalPrice:  100,
+			NmID:        1001,
+			Brand:       "Brand",
+			Status:      200,
+		}},
+		Locale:          "EN",
+		CustomerID:      "cust",
+		DeliveryService: "meest",
+		Shardkey:        "1",
+		SmID:            1,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("marshal order: %v", err)
+	}
+	return b
+}
+
+func testRetryPolicy(attempts int) RetryPolicy {
+	return RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+}
+
+func assertQuarantined(t *testing.T, w *mocks.MessageWriterMock, attempts string) {
+	t.Helper()
+	calls := w.WriteMessagesCalls()
+	if len(calls) != 1 || len(calls[0].Messages) != 1 {
+		t.Fatalf("expected exactly one quarantined message, got %d calls", len(calls))
+	}
+	headers := make(map[string]string)
+	for _, h := range calls[0].Messages[0].Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers[HeaderDLQReason] != ReasonUpsertFailed {
+		t.Fatalf("expected reason %s, got %q", ReasonUpsertFailed, headers[HeaderDLQReason])
+	}
+	if headers[HeaderAttempts] != attempts {
+		t.Fatalf("expected %s attempts header, got %q", attempts, headers[HeaderAttempts])
+	}
+}
+
+func TestConsume_SkipsStaleOrderWithoutCaching(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	readerMock := newReaderMock(kafka.Message{
+		Value:   orderJSON(t, "ORDER6"),
+		Time:    ts,
+		Headers: []kafka.Header{{Key: HeaderOrderVersion, Value: []byte("7")}},
+	})
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(_ context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		if rec.Version != 7 {
+			t.Fatalf("expected version 7 from header, got %d", rec.Version)
+		}
+		return repo.Stale, nil
+	}
+	cacheMock := &mocks.StoreMock{
+		SetEntryFunc: func(string, *cache.Entry) { t.Fatalf("cache must not be updated for a stale order") },
+	}
+
+	p := &processor{
+		repo:          repoMock,
+		cache:         cacheMock,
+		validator:     validation.New(),
+		versionSource: VersionFromHeader,
+	}
+	if err := consume(context.Background(), readerMock, p); err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if got := p.staleSkipped.Load(); got != 1 {
+		t.Fatalf("expected 1 skipped stale write, got %d", got)
+	}
+	if len(readerMock.CommitMessagesCalls()) != 1 {
+		t.Fatalf("expected stale message to be committed")
+	}
+}
+
+func TestConsume_SkipsAlreadyProcessedMessage(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{
+		Topic:     "orders",
+		Partition: 2,
+		Offset:    17,
+		Value:     orderJSON(t, "ORDER7"),
+	})
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(_ context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		want := repo.MessageRef{Topic: "orders", Partition: 2, Offset: 17}
+		if rec.Source == nil || *rec.Source != want {
+			t.Fatalf("expected source %+v, got %+v", want, rec.Source)
+		}
+		return repo.Duplicate, nil
+	}
+	cacheMock := &mocks.StoreMock{
+		SetEntryFunc: func(string, *cache.Entry) { t.Fatalf("cache must not be updated for a replayed message") },
+	}
+
+	p := &processor{repo: repoMock, cache: cacheMock, validator: validation.New()}
+	if err := consume(context.Background(), readerMock, p); err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if got := p.duplicates.Load(); got != 1 {
+		t.Fatalf("expected 1 duplicate, got %d", got)
+	}
+	if len(readerMock.CommitMessagesCalls()) != 1 {
+		t.Fatalf("expected replayed message to be committed")
+	}
+}
+
+func TestConsume_DeletesOrderOnTombstone(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{Topic: "orders", Offset: 3, Key: []byte("ORDER8")})
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.DeleteOrderFunc = func(_ context.Context, rec repo.OrderDeletion) (repo.UpsertStatus, error) {
+		if rec.OrderUID != "ORDER8" || rec.Source == nil || rec.Source.Offset != 3 {
+			t.Fatalf("unexpected deletion %+v", rec)
+		}
+		return repo.Applied, nil
+	}
+	cacheMock := &mocks.StoreMock{DeleteFunc: func(string) {}}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      repoMock,
+		cache:     cacheMock,
+		validator: validation.New(),
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if calls := cacheMock.DeleteCalls(); len(calls) != 1 || calls[0].ID != "ORDER8" {
+		t.Fatalf("expected ORDER8 to be evicted from cache, got %+v", calls)
+	}
+	if len(readerMock.CommitMessagesCalls()) != 1 {
+		t.Fatalf("expected tombstone to be committed")
+	}
+}
+
+func TestConsume_ReportsMetrics(t *testing.T) {
+	readerMock := newReaderMock(
+		kafka.Message{Topic: "orders", Partition: 1, Offset: 4, HighWaterMark: 10, Value: orderJSON(t, "ORDER9")},
+		kafka.Message{Topic: "orders", Partition: 1, Offset: 5, HighWaterMark: 10, Value: []byte("{broken")},
+	)
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		return repo.Applied, nil
+	}
+	metricsMock := &mocks.MetricsMock{
+		MessageConsumedFunc: func(string, int, int64) {},
+		MessageSkippedFunc:  func(string) {},
+		ObserveUpsertFunc:   func(string, time.Duration) {},
+	}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      repoMock,
+		cache:     &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}},
+		validator: validation.New(),
+		metrics:   metricsMock,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+
+	consumed := metricsMock.MessageConsumedCalls()
+	if len(consumed) != 2 || consumed[0].Lag != 5 || consumed[1].Lag != 4 {
+		t.Fatalf("unexpected consumed calls: %+v", consumed)
+	}
+	if skipped := metricsMock.MessageSkippedCalls(); len(skipped) != 1 || skipped[0].Reason != ReasonInvalidJSON {
+		t.Fatalf("unexpected skipped calls: %+v", skipped)
+	}
+	if upserts := metricsMock.ObserveUpsertCalls(); len(upserts) != 1 || upserts[0].Kind != "order" {
+		t.Fatalf("unexpected upsert observations: %+v", upserts)
+	}
+}
@@ -0,0 +1,82 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers attached to every dead-lettered or quarantined message.
+const (
+	HeaderDLQReason       = "x-dlq-reason"
+	HeaderDLQError        = "x-dlq-error"
+	HeaderSourceTopic     = "x-source-topic"
+	HeaderSourcePartition = "x-source-partition"
+	HeaderSourceOffset    = "x-source-offset"
+	HeaderSourceTimestamp = "x-source-timestamp"
+	HeaderAttempts        = "x-attempts"
+)
+
+// Reasons reported in the x-dlq-reason header.
+const (
+	ReasonInvalidJSON  = "invalid_json"
+	ReasonInvalidOrder = "invalid_order"
+	ReasonUpsertFailed = "upsert_failed"
+	ReasonUnknownEvent = "unknown_event"
+	// ReasonInvalidPayload covers unsupported content types, non-JSON
+	// payloads that could not be decoded and unknown schema versions.
+	ReasonInvalidPayload = "invalid_payload"
+)
+
+// MessageWriter abstracts kafka writer operations used for the dead-letter topic.
+//
+//go:generate moq -pkg mocks -skip-ensure -out ../mocks/kafka_writer_mock.go . MessageWriter
+type MessageWriter interface {
+	WriteMessages(context.Context, ...kafka.Message) error
+	Close() error
+}
+
+func newDLQWriter(brokers, topic string, transport *kafka.Transport) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Transport:    transport,
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+}
+
+func attemptsHeader(n int) kafka.Header {
+	return kafka.Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(n))}
+}
+
+// deadLetter republishes the original bytes of m to the dead-letter topic.
+// A nil writer means the dead-letter topic is disabled.
+func deadLetter(ctx context.Context, w MessageWriter, m kafka.Message, reason string, cause error, extra ...kafka.Header) error {
+	if w == nil {
+		return nil
+	}
+
+	headers := make([]kafka.Header, 0, len(m.Headers)+len(extra)+6)
+	headers = append(headers, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderSourceTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderSourcePartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderSourceOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderSourceTimestamp, Value: []byte(m.Time.UTC().Format(time.RFC3339Nano))},
+	)
+	if cause != nil {
+		headers = append(headers, kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())})
+	}
+	headers = append(headers, extra...)
+
+	return w.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+}
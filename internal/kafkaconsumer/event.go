@@ -0,0 +1,60 @@
+package kafkaconsumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+	"github.com/kosovrzn/wb-tech-l0/internal/upcast"
+)
+
+// HeaderEventType selects the event type of a message whose value is the bare
+// event payload. Without it the value is either a domain.Envelope or, when it
+// has no "type" field, a full order snapshot.
+const HeaderEventType = "x-event-type"
+
+// HeaderSchemaVersion gives the schema_version of a JSON snapshot and takes
+// precedence over the field in the payload.
+const HeaderSchemaVersion = "x-schema-version"
+
+// event is a message value split into its type, body and body version.
+type event struct {
+	typ     domain.EventType
+	version int64
+	payload []byte
+}
+
+func parseEvent(m kafka.Message) (event, error) {
+	if t, ok := headerValue(m, HeaderEventType); ok && t != "" {
+		return event{typ: domain.EventType(t), payload: m.Value}, nil
+	}
+
+	var env domain.Envelope
+	if err := json.Unmarshal(m.Value, &env); err != nil {
+		return event{}, err
+	}
+	if env.Type == "" {
+		return event{typ: domain.EventSnapshot, payload: m.Value}, nil
+	}
+	if len(env.Payload) == 0 {
+		return event{}, errors.New("envelope has no payload")
+	}
+	return event{typ: env.Type, version: env.Version, payload: env.Payload}, nil
+}
+
+// upcastSnapshot brings a JSON snapshot payload to domain.SchemaVersion.
+func upcastSnapshot(m kafka.Message, payload []byte) ([]byte, error) {
+	var version int
+	if h, ok := headerValue(m, HeaderSchemaVersion); ok && h != "" {
+		v, err := strconv.Atoi(h)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("invalid %s header %q", HeaderSchemaVersion, h)
+		}
+		version = v
+	}
+	return upcast.Order(payload, version)
+}
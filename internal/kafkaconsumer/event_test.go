@@ -0,0 +1,340 @@
+package kafkaconsumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/codec"
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+	"github.com/kosovrzn/wb-tech-l0/internal/validation"
+)
+
+func TestParseEvent(t *testing.T) {
+	snapshot := orderJSON(t, "ORDER1")
+
+	cases := []struct {
+		name        string
+		msg         kafka.Message
+		wantType    domain.EventType
+		wantVersion int64
+		wantPayload string
+	}{
+		{"bare snapshot", kafka.Message{Value: snapshot}, domain.EventSnapshot, 0, string(snapshot)},
+		{
+			"header",
+			kafka.Message{
+				Value:   []byte(`{"order_uid":"ORDER1","status":3}`),
+				Headers: []kafka.Header{{Key: HeaderEventType, Value: []byte(domain.EventItemStatus)}},
+			},
+			domain.EventItemStatus, 0, `{"order_uid":"ORDER1","status":3}`,
+		},
+		{
+			"envelope",
+			kafka.Message{Value: []byte(`{"type":"order.cancelled","version":7,"payload":{"order_uid":"ORDER1"}}`)},
+			domain.EventCancelled, 7, `{"order_uid":"ORDER1"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ev, err := parseEvent(tc.msg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ev.typ != tc.wantType || ev.version != tc.wantVersion || string(ev.payload) != tc.wantPayload {
+				t.Fatalf("unexpected event: type=%s version=%d payload=%s", ev.typ, ev.version, ev.payload)
+			}
+		})
+	}
+}
+
+func TestConsume_AppliesPatchAndRefreshesCache(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{
+		Offset:  4,
+		Value:   []byte(`{"type":"order.item_status","payload":{"order_uid":"ORDER1","chrt_id":9934930,"status":202}}`),
+		Headers: []kafka.Header{{Key: HeaderOrderVersion, Value: []byte("11")}},
+	})
+
+	updated := []byte(`{"order_uid":"ORDER1","items":[{"status":202}]}`)
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.ApplyPatchFunc = func(_ context.Context, rec repo.OrderPatch) (repo.UpsertStatus, []byte, error) {
+		p, ok := rec.Patch.(*domain.ItemStatusPatch)
+		if !ok || p.OrderUID != "ORDER1" || p.ChrtID != 9934930 || p.Status != 202 {
+			t.Fatalf("unexpected patch %#v", rec.Patch)
+		}
+		if rec.Version != 11 || rec.Source == nil || rec.Source.Offset != 4 {
+			t.Fatalf("unexpected patch record %+v", rec)
+		}
+		return repo.Applied, updated, nil
+	}
+	cacheMock := &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:          repoMock,
+		cache:         cacheMock,
+		validator:     validation.New(),
+		versionSource: VersionFromHeader,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+
+	sets := cacheMock.SetEntryCalls()
+	if len(sets) != 1 || sets[0].ID != "ORDER1" || string(sets[0].E.Body) != string(updated) {
+		t.Fatalf("expected cache to hold the patched order, got %+v", sets)
+	}
+	if n := len(readerMock.CommitMessagesCalls()); n != 1 {
+		t.Fatalf("expected one commit, got %d", n)
+	}
+}
+
+func TestConsume_DeadLettersPatchThatInvalidatesOrder(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{
+		Value: []byte(`{"type":"order.delivery","payload":{"order_uid":"ORDER1","city":""}}`),
+	})
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.ApplyPatchFunc = func(context.Context, repo.OrderPatch) (repo.UpsertStatus, []byte, error) {
+		return 0, nil, fmt.Errorf("order ORDER1: %w: city is required", repo.ErrInvalidOrder)
+	}
+	dlqMock := &mocks.MessageWriterMock{}
+	dlqMock.WriteMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+	quarantineMock := &mocks.MessageWriterMock{}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:       repoMock,
+		cache:      &mocks.StoreMock{},
+		validator:  validation.New(),
+		dlq:        dlqMock,
+		quarantine: quarantineMock,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+
+	calls := dlqMock.WriteMessagesCalls()
+	if len(calls) != 1 || len(quarantineMock.WriteMessagesCalls()) != 0 {
+		t.Fatalf("expected the patch in the DLQ only, got %d DLQ writes", len(calls))
+	}
+	if v, _ := headerValue(calls[0].Messages[0], HeaderDLQReason); v != ReasonInvalidOrder {
+		t.Fatalf("expected reason %s, got %s", ReasonInvalidOrder, v)
+	}
+	if n := len(readerMock.CommitMessagesCalls()); n != 1 {
+		t.Fatalf("expected the message to be committed, got %d commits", n)
+	}
+}
+
+func TestConsume_RejectsUnknownEventType(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{
+		Value:   []byte(`{"order_uid":"ORDER1"}`),
+		Headers: []kafka.Header{{Key: HeaderEventType, Value: []byte("order.teleported")}},
+	})
+	dlqMock := &mocks.MessageWriterMock{}
+	dlqMock.WriteMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      &mocks.RepositoryMock{},
+		cache:     &mocks.StoreMock{},
+		validator: validation.New(),
+		dlq:       dlqMock,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+
+	calls := dlqMock.WriteMessagesCalls()
+	if len(calls) != 1 {
+		t.Fatalf("expected one DLQ write, got %d", len(calls))
+	}
+	if v, _ := headerValue(calls[0].Messages[0], HeaderDLQReason); v != ReasonUnknownEvent {
+		t.Fatalf("expected reason %s, got %s", ReasonUnknownEvent, v)
+	}
+}
+
+func TestPatchesApplyToOrder(t *testing.T) {
+	o := &domain.Order{
+		OrderUID: "ORDER1",
+		Delivery: domain.Delivery{City: "Old", Address: "Old street"},
+		Items:    []domain.Item{{ChrtID: 1, RID: "a", Status: 1}, {ChrtID: 2, RID: "b", Status: 1}},
+	}
+	city := "New"
+	amount := 500
+
+	patches := []domain.Patch{
+		&domain.ItemStatusPatch{OrderUID: "ORDER1", ChrtID: 2, Status: 7},
+		&domain.DeliveryPatch{OrderUID: "ORDER1", City: &city},
+		&domain.PaymentPatch{OrderUID: "ORDER1", Amount: &amount},
+		&domain.Cancellation{OrderUID: "ORDER1", Reason: "customer"},
+	}
+	for _, p := range patches {
+		if err := p.Apply(o); err != nil {
+			t.Fatalf("apply %T: %v", p, err)
+		}
+	}
+
+	if o.Items[0].Status != 1 || o.Items[1].Status != 7 {
+		t.Fatalf("unexpected item statuses: %+v", o.Items)
+	}
+	if o.Delivery.City != "New" || o.Delivery.Address != "Old street" {
+		t.Fatalf("unexpected delivery: %+v", o.Delivery)
+	}
+	if o.Payment.Amount != 500 {
+		t.Fatalf("unexpected payment: %+v", o.Payment)
+	}
+	if o.CancelledAt == nil || o.CancelReason != "customer" {
+		t.Fatalf("expected order to be cancelled, got %v %q", o.CancelledAt, o.CancelReason)
+	}
+	if err := (&domain.ItemStatusPatch{OrderUID: "ORDER1", ChrtID: 99}).Apply(o); err == nil {
+		t.Fatalf("expected error for unknown item")
+	}
+}
+
+func TestConsume_StoresCanonicalJSON(t *testing.T) {
+	var o domain.Order
+	if err := json.Unmarshal(orderJSON(t, "ORDER1"), &o); err != nil {
+		t.Fatal(err)
+	}
+	want, err := codec.Canonical(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Indented input with a non-UTC timestamp must be stored in canonical form.
+	indented, _ := json.MarshalIndent(o, "", "  ")
+	indented = bytes.Replace(indented, []byte(o.DateCreated.UTC().Format(time.RFC3339)),
+		[]byte(o.DateCreated.In(time.FixedZone("MSK", 3*3600)).Format(time.RFC3339)), 1)
+	readerMock := newReaderMock(kafka.Message{Value: indented})
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(_ context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		if !bytes.Equal(rec.Raw, want) {
+			t.Fatalf("expected canonical raw payload\n got %s\nwant %s", rec.Raw, want)
+		}
+		return repo.Applied, nil
+	}
+
+	err = consume(context.Background(), readerMock, &processor{
+		repo:      repoMock,
+		cache:     &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}},
+		validator: validation.New(),
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if len(repoMock.UpsertOrderCalls()) != 1 {
+		t.Fatalf("expected one upsert")
+	}
+}
+
+func TestConsume_RejectsUnsupportedContentType(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{
+		Value:   []byte("order_uid;track_number"),
+		Headers: []kafka.Header{{Key: codec.HeaderContentType, Value: []byte("text/csv")}},
+	})
+	dlqMock := &mocks.MessageWriterMock{}
+	dlqMock.WriteMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      &mocks.RepositoryMock{},
+		cache:     &mocks.StoreMock{},
+		validator: validation.New(),
+		codecs:    codec.NewRegistry(nil),
+		dlq:       dlqMock,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	calls := dlqMock.WriteMessagesCalls()
+	if len(calls) != 1 {
+		t.Fatalf("expected one DLQ write, got %d", len(calls))
+	}
+	if v, _ := headerValue(calls[0].Messages[0], HeaderDLQReason); v != ReasonInvalidPayload {
+		t.Fatalf("expected reason %s, got %s", ReasonInvalidPayload, v)
+	}
+}
+
+// downRegistry is a schema registry that cannot be reached.
+type downRegistry struct{ calls int }
+
+func (r *downRegistry) Schema(context.Context, int) (avro.Schema, error) {
+	r.calls++
+	return nil, fmt.Errorf("schema: %w", codec.ErrRegistryUnavailable)
+}
+
+func TestConsume_StopsWhileSchemaRegistryIsDown(t *testing.T) {
+	readerMock := newReaderMock(kafka.Message{
+		Value:   []byte{0, 0, 0, 0, 7, 2},
+		Headers: []kafka.Header{{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeAvro)}},
+	})
+	dlqMock := &mocks.MessageWriterMock{}
+	registry := &downRegistry{}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      &mocks.RepositoryMock{},
+		cache:     &mocks.StoreMock{},
+		validator: validation.New(),
+		codecs:    codec.NewRegistry(registry),
+		dlq:       dlqMock,
+		retry:     testRetryPolicy(2),
+	})
+	if !errors.Is(err, codec.ErrRegistryUnavailable) {
+		t.Fatalf("expected consume to stop on the registry error, got %v", err)
+	}
+	if registry.calls != 2 {
+		t.Fatalf("expected 2 lookups, got %d", registry.calls)
+	}
+	if len(dlqMock.WriteMessagesCalls()) != 0 || len(readerMock.CommitMessagesCalls()) != 0 {
+		t.Fatal("expected the message to be neither dead-lettered nor committed")
+	}
+}
+
+func TestConsume_UpcastsLegacySnapshot(t *testing.T) {
+	legacy := orderJSON(t, "ORDER1")
+	readerMock := newReaderMock(
+		kafka.Message{Offset: 0, Value: legacy},
+		kafka.Message{Offset: 1, Value: legacy, Headers: []kafka.Header{{Key: HeaderSchemaVersion, Value: []byte("99")}}},
+	)
+	dlqMock := &mocks.MessageWriterMock{}
+	dlqMock.WriteMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(_ context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		var stored domain.Order
+		if err := json.Unmarshal(rec.Raw, &stored); err != nil {
+			t.Fatalf("stored payload: %v", err)
+		}
+		if stored.SchemaVersion != domain.SchemaVersion || rec.Order.SchemaVersion != domain.SchemaVersion {
+			t.Fatalf("expected schema_version %d, got %d", domain.SchemaVersion, stored.SchemaVersion)
+		}
+		return repo.Applied, nil
+	}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      repoMock,
+		cache:     &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}},
+		validator: validation.New(),
+		dlq:       dlqMock,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if n := len(repoMock.UpsertOrderCalls()); n != 1 {
+		t.Fatalf("expected one upsert, got %d", n)
+	}
+	calls := dlqMock.WriteMessagesCalls()
+	if len(calls) != 1 {
+		t.Fatalf("expected the unknown schema version in DLQ, got %d writes", len(calls))
+	}
+	if v, _ := headerValue(calls[0].Messages[0], HeaderDLQReason); v != ReasonInvalidPayload {
+		t.Fatalf("expected reason %s, got %s", ReasonInvalidPayload, v)
+	}
+}
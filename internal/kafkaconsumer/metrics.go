@@ -0,0 +1,42 @@
+package kafkaconsumer
+
+import (
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Metrics receives consumer instrumentation. A nil Metrics disables it.
+//
+//go:generate moq -pkg mocks -skip-ensure -out ../mocks/consumer_metrics_mock.go . Metrics
+type Metrics interface {
+	// MessageConsumed is called for every fetched message; lag is the number
+	// of messages behind the partition's high-water mark.
+	MessageConsumed(topic string, partition int, lag int64)
+	// MessageSkipped is called when a message is parked in the DLQ or
+	// quarantine; reason is the x-dlq-reason value.
+	MessageSkipped(reason string)
+	// UpsertFailed is called when a write gives up after its retries.
+	UpsertFailed()
+	// ObserveUpsert records the duration of one repository write of the
+	// given kind: "batch", "order", "patch" or "delete".
+	ObserveUpsert(kind string, d time.Duration)
+	// ObserveReader receives the periodic kafka-go reader stats.
+	ObserveReader(stats kafka.ReaderStats)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) MessageConsumed(string, int, int64)  {}
+func (nopMetrics) MessageSkipped(string)               {}
+func (nopMetrics) UpsertFailed()                       {}
+func (nopMetrics) ObserveUpsert(string, time.Duration) {}
+func (nopMetrics) ObserveReader(kafka.ReaderStats)     {}
+
+// lag returns how far m is behind the high-water mark of its partition.
+func lag(m kafka.Message) int64 {
+	if m.HighWaterMark <= 0 {
+		return 0
+	}
+	return max(m.HighWaterMark-m.Offset-1, 0)
+}
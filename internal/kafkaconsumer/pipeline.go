@@ -0,0 +1,220 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type result struct {
+	msg    kafka.Message
+	commit bool
+	err    error
+}
+
+// consume fetches messages and fans them out to p.workers goroutines.
+// Messages of one partition (or one key when p.shardByKey is set) always land
+// on the same worker, so their relative order is preserved, while offsets are
+// committed strictly in order per partition, once per processed batch.
+func consume(ctx context.Context, reader MessageReader, p *processor) error {
+	if p.metrics == nil {
+		p.metrics = nopMetrics{}
+	}
+	workers := max(p.workers, 1)
+	inFlight := max(p.maxInFlight, workers, p.batchSize)
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	sem := make(chan struct{}, inFlight)
+	results := make(chan []result, inFlight)
+	queues := make([]chan kafka.Message, workers)
+
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, inFlight)
+		wg.Add(1)
+		go func(q <-chan kafka.Message) {
+			defer wg.Done()
+			p.work(runCtx, q, results)
+		}(queues[i])
+	}
+
+	tracker := newOffsetTracker()
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		for batch := range results {
+			commits := make(map[partitionKey]kafka.Message)
+			for _, res := range batch {
+				<-sem
+				if res.err != nil {
+					cancel(res.err)
+					continue
+				}
+				if !res.commit {
+					continue
+				}
+				if m, ok := tracker.complete(res.msg); ok {
+					commits[partitionKey{m.Topic, m.Partition}] = m
+				}
+			}
+			if len(commits) == 0 {
+				continue
+			}
+			msgs := make([]kafka.Message, 0, len(commits))
+			for _, m := range commits {
+				msgs = append(msgs, m)
+			}
+			if err := reader.CommitMessages(ctx, msgs...); err != nil {
+				log.Printf("commit failed: %v", err)
+			}
+		}
+	}()
+
+	var fetchErr error
+fetch:
+	for {
+		m, err := reader.FetchMessage(runCtx)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				fetchErr = err
+			}
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-runCtx.Done():
+			break fetch
+		}
+		tracker.track(m)
+		p.metrics.MessageConsumed(m.Topic, m.Partition, lag(m))
+		queues[shard(m, workers, p.shardByKey)] <- m
+	}
+
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	close(results)
+	<-committed
+
+	if cause := context.Cause(runCtx); cause != nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return fetchErr
+}
+
+// work collects messages from q into batches of up to p.batchSize, flushing
+// early once p.batchWait has passed since the first message of the batch.
+func (p *processor) work(ctx context.Context, q <-chan kafka.Message, out chan<- []result) {
+	size := max(p.batchSize, 1)
+	batch := make([]kafka.Message, 0, size)
+	var timer *time.Timer
+	var timeout <-chan time.Time
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) == 0 || ctx.Err() != nil {
+			batch = batch[:0]
+			return
+		}
+		out <- p.handleBatch(ctx, batch)
+		batch = make([]kafka.Message, 0, size)
+	}
+
+	for {
+		select {
+		case m, ok := <-q:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, m)
+			if len(batch) >= size || p.batchWait <= 0 {
+				flush()
+			} else if timer == nil {
+				timer = time.NewTimer(p.batchWait)
+				timeout = timer.C
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+func shard(m kafka.Message, workers int, byKey bool) int {
+	if byKey && len(m.Key) > 0 {
+		h := fnv.New32a()
+		h.Write(m.Key)
+		return int(h.Sum32() % uint32(workers))
+	}
+	return m.Partition % workers
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+type partitionState struct {
+	pending []int64
+	done    map[int64]kafka.Message
+}
+
+// offsetTracker remembers fetched offsets per partition and releases the
+// highest offset whose predecessors have all completed.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionState
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[partitionKey]*partitionState)}
+}
+
+func (t *offsetTracker) track(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	k := partitionKey{m.Topic, m.Partition}
+	st, ok := t.partitions[k]
+	if !ok {
+		st = &partitionState{done: make(map[int64]kafka.Message)}
+		t.partitions[k] = st
+	}
+	st.pending = append(st.pending, m.Offset)
+}
+
+// complete marks m as processed and returns the message to commit, if any.
+func (t *offsetTracker) complete(m kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.partitions[partitionKey{m.Topic, m.Partition}]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	st.done[m.Offset] = m
+
+	var last kafka.Message
+	var ready bool
+	for len(st.pending) > 0 {
+		dm, ok := st.done[st.pending[0]]
+		if !ok {
+			break
+		}
+		delete(st.done, st.pending[0])
+		st.pending = st.pending[1:]
+		last, ready = dm, true
+	}
+	return last, ready
+}
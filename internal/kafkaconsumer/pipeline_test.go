@@ -0,0 +1,248 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+	"github.com/kosovrzn/wb-tech-l0/internal/validation"
+)
+
+func TestOffsetTrackerReleasesContiguousOffsets(t *testing.T) {
+	tr := newOffsetTracker()
+	msgs := []kafka.Message{
+		{Topic: "orders", Partition: 0, Offset: 10},
+		{Topic: "orders", Partition: 0, Offset: 11},
+		{Topic: "orders", Partition: 0, Offset: 12},
+	}
+	for _, m := range msgs {
+		tr.track(m)
+	}
+
+	if _, ok := tr.complete(msgs[1]); ok {
+		t.Fatalf("offset 11 must wait for 10")
+	}
+	m, ok := tr.complete(msgs[0])
+	if !ok || m.Offset != 11 {
+		t.Fatalf("expected offset 11 to be released, got %d ok=%v", m.Offset, ok)
+	}
+	m, ok = tr.complete(msgs[2])
+	if !ok || m.Offset != 12 {
+		t.Fatalf("expected offset 12 to be released, got %d ok=%v", m.Offset, ok)
+	}
+}
+
+func TestConsume_KeepsPartitionOrderWithWorkers(t *testing.T) {
+	const partitions, perPartition = 4, 25
+
+	var msgs []kafka.Message
+	for off := 0; off < perPartition; off++ {
+		for p := 0; p < partitions; p++ {
+			uid := fmt.Sprintf("P%dO%d", p, off)
+			msgs = append(msgs, kafka.Message{
+				Topic:     "orders",
+				Partition: p,
+				Offset:    int64(off),
+				Value:     orderJSON(t, uid),
+			})
+		}
+	}
+	byUID := make(map[string]kafka.Message, len(msgs))
+	for _, m := range msgs {
+		byUID[fmt.Sprintf("P%dO%d", m.Partition, m.Offset)] = m
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int][]int64)
+	commits := make(map[int][]int64)
+
+	readerMock := newReaderMock(msgs...)
+	readerMock.CommitMessagesFunc = func(_ context.Context, ms ...kafka.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, m := range ms {
+			commits[m.Partition] = append(commits[m.Partition], m.Offset)
+		}
+		return nil
+	}
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrderFunc = func(_ context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		m := byUID[rec.Order.OrderUID]
+		mu.Lock()
+		seen[m.Partition] = append(seen[m.Partition], m.Offset)
+		mu.Unlock()
+		return repo.Applied, nil
+	}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:        repoMock,
+		cache:       &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}},
+		validator:   validation.New(),
+		workers:     3,
+		maxInFlight: 8,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+
+	for p := 0; p < partitions; p++ {
+		if len(seen[p]) != perPartition {
+			t.Fatalf("partition %d: expected %d messages, got %d", p, perPartition, len(seen[p]))
+		}
+		for i, off := range seen[p] {
+			if off != int64(i) {
+				t.Fatalf("partition %d processed out of order: %v", p, seen[p])
+			}
+		}
+		cs := commits[p]
+		if len(cs) == 0 || cs[len(cs)-1] != perPartition-1 {
+			t.Fatalf("partition %d: expected final commit at %d, got %v", p, perPartition-1, cs)
+		}
+		for i := 1; i < len(cs); i++ {
+			if cs[i] <= cs[i-1] {
+				t.Fatalf("partition %d: commits not increasing: %v", p, cs)
+			}
+		}
+	}
+}
+
+func TestConsume_StoresBatchInOneTransaction(t *testing.T) {
+	var msgs []kafka.Message
+	for i := 0; i < 4; i++ {
+		msgs = append(msgs, kafka.Message{Topic: "orders", Offset: int64(i), Value: orderJSON(t, fmt.Sprintf("B%d", i))})
+	}
+	readerMock := newReaderMock(msgs...)
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrdersFunc = func(_ context.Context, orders []repo.OrderWithRaw) ([]repo.UpsertStatus, error) {
+		if len(orders) != 4 {
+			t.Fatalf("expected a batch of 4 orders, got %d", len(orders))
+		}
+		return make([]repo.UpsertStatus, len(orders)), nil
+	}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:      repoMock,
+		cache:     &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}},
+		validator: validation.New(),
+		batchSize: 4,
+		batchWait: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	if n := len(repoMock.UpsertOrdersCalls()); n != 1 {
+		t.Fatalf("expected one batch upsert, got %d", n)
+	}
+	commits := readerMock.CommitMessagesCalls()
+	if len(commits) != 1 || len(commits[0].Messages) != 1 || commits[0].Messages[0].Offset != 3 {
+		t.Fatalf("expected a single commit of offset 3, got %+v", commits)
+	}
+}
+
+func TestConsume_SplitsFailingBatchToIsolateBadRecord(t *testing.T) {
+	uids := []string{"G0", "G1", "BAD", "G3"}
+	var msgs []kafka.Message
+	for i, uid := range uids {
+		msgs = append(msgs, kafka.Message{Topic: "orders", Offset: int64(i), Value: orderJSON(t, uid)})
+	}
+	readerMock := newReaderMock(msgs...)
+
+	violation := &pgconn.PgError{Code: "23514"}
+	var mu sync.Mutex
+	stored := make(map[string]bool)
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrdersFunc = func(_ context.Context, orders []repo.OrderWithRaw) ([]repo.UpsertStatus, error) {
+		for _, o := range orders {
+			if o.Order.OrderUID == "BAD" {
+				return nil, violation
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, o := range orders {
+			stored[o.Order.OrderUID] = true
+		}
+		return make([]repo.UpsertStatus, len(orders)), nil
+	}
+	repoMock.UpsertOrderFunc = func(_ context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
+		if rec.Order.OrderUID == "BAD" {
+			return 0, violation
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		stored[rec.Order.OrderUID] = true
+		return repo.Applied, nil
+	}
+	quarantineMock := &mocks.MessageWriterMock{}
+	quarantineMock.WriteMessagesFunc = func(context.Context, ...kafka.Message) error { return nil }
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:       repoMock,
+		cache:      &mocks.StoreMock{SetEntryFunc: func(string, *cache.Entry) {}},
+		validator:  validation.New(),
+		quarantine: quarantineMock,
+		batchSize:  4,
+		batchWait:  time.Second,
+	})
+	if err != nil {
+		t.Fatalf("consume returned error: %v", err)
+	}
+	for _, uid := range []string{"G0", "G1", "G3"} {
+		if !stored[uid] {
+			t.Fatalf("expected %s to be stored despite the bad record", uid)
+		}
+	}
+	assertQuarantined(t, quarantineMock, "1")
+
+	commits := readerMock.CommitMessagesCalls()
+	if len(commits) != 1 || commits[0].Messages[0].Offset != 3 {
+		t.Fatalf("expected the whole batch to be committed up to offset 3, got %+v", commits)
+	}
+}
+
+func TestConsume_StopsOnRetryableBatchError(t *testing.T) {
+	var msgs []kafka.Message
+	for i := 0; i < 4; i++ {
+		msgs = append(msgs, kafka.Message{Topic: "orders", Offset: int64(i), Value: orderJSON(t, fmt.Sprintf("O%d", i))})
+	}
+	readerMock := newReaderMock(msgs...)
+
+	repoMock := &mocks.RepositoryMock{}
+	repoMock.UpsertOrdersFunc = func(context.Context, []repo.OrderWithRaw) ([]repo.UpsertStatus, error) {
+		return nil, &pgconn.PgError{Code: "08006"}
+	}
+	quarantineMock := &mocks.MessageWriterMock{}
+
+	err := consume(context.Background(), readerMock, &processor{
+		repo:       repoMock,
+		cache:      &mocks.StoreMock{},
+		validator:  validation.New(),
+		quarantine: quarantineMock,
+		retry:      testRetryPolicy(2),
+		batchSize:  4,
+		batchWait:  time.Second,
+	})
+	if err == nil {
+		t.Fatal("expected consume to stop on an outage")
+	}
+	// An outage is not split into single writes nor quarantined.
+	if n := len(repoMock.UpsertOrdersCalls()); n != 2 {
+		t.Fatalf("expected 2 attempts of the whole batch, got %d", n)
+	}
+	if len(repoMock.UpsertOrderCalls()) != 0 || len(quarantineMock.WriteMessagesCalls()) != 0 {
+		t.Fatal("expected no single writes and nothing quarantined")
+	}
+	if n := len(readerMock.CommitMessagesCalls()); n != 0 {
+		t.Fatalf("expected no commit, got %d", n)
+	}
+}
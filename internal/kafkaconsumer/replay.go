@@ -0,0 +1,475 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+	"github.com/kosovrzn/wb-tech-l0/internal/validation"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Starting points of a replay.
+const (
+	ReplayFromEarliest = "earliest"
+	ReplayFromOffsets  = "offsets"
+	ReplayFromTime     = "time"
+)
+
+// ReplayOptions selects what a replay re-reads and how it is applied.
+type ReplayOptions struct {
+	// From is ReplayFromEarliest, ReplayFromOffsets or ReplayFromTime.
+	From string
+	// Offsets holds the start offset per partition for ReplayFromOffsets.
+	// Partitions that are not listed are left untouched.
+	Offsets map[int]int64
+	// Since is the timestamp for ReplayFromTime.
+	Since time.Time
+	// DryRun decodes and validates messages without writing anything and
+	// without moving the consumer group.
+	DryRun bool
+	// Force overwrites stored orders even if they carry the same or a newer
+	// version or the message was already processed.
+	Force bool
+}
+
+// ReplayStats summarises a finished replay.
+type ReplayStats struct {
+	Partitions int
+	Messages   int64
+	Applied    int64
+	Stale      int64
+	Duplicates int64
+	Rejected   int64
+}
+
+// errReplayDone is returned by the replay reader once every partition has
+// been read up to the end offset captured when the replay started.
+var errReplayDone = errors.New("replay done")
+
+// Replay resets the consumer group of cfg.Topic to the position chosen by opts
+// and re-reads the topic up to its current end through the regular consume
+// pipeline. The group must have no active members, i.e. storesvc is stopped.
+// In dry-run mode r may be nil.
+func Replay(ctx context.Context, cfg Config, opts ReplayOptions, r repo.Repository) (ReplayStats, error) {
+	conn, err := cfg.Security.connectors()
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	brokers := strings.Split(cfg.Brokers, ",")
+	client := &kafka.Client{Addr: kafka.TCP(brokers...), Timeout: 30 * time.Second, Transport: conn.transport}
+
+	ranges, err := replayRanges(ctx, client, cfg.Topic, opts)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+
+	commit := func(ctx context.Context, offsets map[int]int64) error {
+		return commitGroupOffsets(ctx, client, cfg.Group, cfg.Topic, offsets)
+	}
+	if opts.DryRun {
+		r = dryRunRepo{}
+		commit = func(context.Context, map[int]int64) error { return nil }
+	} else {
+		starts := make(map[int]int64, len(ranges))
+		for _, pr := range ranges {
+			starts[pr.partition] = pr.start
+		}
+		if err := commit(ctx, starts); err != nil {
+			return ReplayStats{}, fmt.Errorf("reset group %s: %w", cfg.Group, err)
+		}
+	}
+
+	sources := make([]partitionSource, 0, len(ranges))
+	for _, pr := range ranges {
+		log.Printf("replay partition %d: offsets [%d, %d)", pr.partition, pr.start, pr.end)
+		if pr.start >= pr.end {
+			continue
+		}
+		rd := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   brokers,
+			Topic:     cfg.Topic,
+			Partition: pr.partition,
+			MinBytes:  1,
+			MaxBytes:  10 << 20,
+			Dialer:    conn.dialer,
+		})
+		if err := rd.SetOffset(pr.start); err != nil {
+			rd.Close()
+			return ReplayStats{}, fmt.Errorf("partition %d: %w", pr.partition, err)
+		}
+		sources = append(sources, partitionSource{reader: rd, end: pr.end})
+	}
+
+	p := &processor{
+		repo:          r,
+		cache:         discardCache{},
+		validator:     validation.New(),
+		retry:         cfg.Retry,
+		workers:       cfg.Workers,
+		maxInFlight:   cfg.MaxInFlight,
+		shardByKey:    cfg.ShardByKey,
+		batchSize:     cfg.BatchSize,
+		batchWait:     cfg.BatchWait,
+		versionSource: cfg.VersionSource,
+		codecs:        cfg.Codecs,
+		force:         opts.Force,
+	}
+	if !opts.DryRun {
+		dlq, quarantine, closeWriters := replayWriters(cfg, conn.transport)
+		defer closeWriters()
+		p.dlq, p.quarantine = dlq, quarantine
+	}
+
+	log.Printf("replay START (topic=%s group=%s from=%s dry_run=%t force=%t partitions=%d)",
+		cfg.Topic, cfg.Group, opts.From, opts.DryRun, opts.Force, len(sources))
+
+	reader := newReplayReader(ctx, sources, commit)
+	defer reader.Close()
+	err = replay(ctx, reader, p)
+
+	stats := ReplayStats{
+		Partitions: len(sources),
+		Messages:   reader.fetched.Load(),
+		Applied:    p.applied.Load(),
+		Stale:      p.staleSkipped.Load(),
+		Duplicates: p.duplicates.Load(),
+		Rejected:   p.rejected.Load(),
+	}
+	return stats, err
+}
+
+// replay runs the consume pipeline until reader is drained.
+func replay(ctx context.Context, reader MessageReader, p *processor) error {
+	err := consume(ctx, reader, p)
+	if errors.Is(err, errReplayDone) {
+		return nil
+	}
+	if err == nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func replayWriters(cfg Config, transport *kafka.Transport) (dlq, quarantine MessageWriter, closeAll func()) {
+	if cfg.QuarantineTopic == "" {
+		cfg.QuarantineTopic = cfg.DLQTopic
+	}
+	var ws []*kafka.Writer
+	closeAll = func() {
+		for _, w := range ws {
+			w.Close()
+		}
+	}
+	if cfg.DLQTopic != "" {
+		w := newDLQWriter(cfg.Brokers, cfg.DLQTopic, transport)
+		ws = append(ws, w)
+		dlq = w
+	}
+	switch {
+	case cfg.QuarantineTopic == "":
+	case cfg.QuarantineTopic == cfg.DLQTopic:
+		quarantine = dlq
+	default:
+		w := newDLQWriter(cfg.Brokers, cfg.QuarantineTopic, transport)
+		ws = append(ws, w)
+		quarantine = w
+	}
+	return dlq, quarantine, closeAll
+}
+
+type partitionRange struct {
+	partition  int
+	start, end int64
+}
+
+// replayRanges resolves the start offset chosen by opts and the current end
+// offset of every partition of topic that takes part in the replay.
+func replayRanges(ctx context.Context, client *kafka.Client, topic string, opts ReplayOptions) ([]partitionRange, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	if len(meta.Topics) != 1 {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+	if err := meta.Topics[0].Error; err != nil {
+		return nil, fmt.Errorf("topic %s: %w", topic, err)
+	}
+
+	var partitions []int
+	for _, p := range meta.Topics[0].Partitions {
+		if opts.From == ReplayFromOffsets {
+			if _, ok := opts.Offsets[p.ID]; !ok {
+				continue
+			}
+		}
+		partitions = append(partitions, p.ID)
+	}
+	if opts.From == ReplayFromOffsets {
+		for p := range opts.Offsets {
+			if !slices.Contains(partitions, p) {
+				return nil, fmt.Errorf("topic %s has no partition %d", topic, p)
+			}
+		}
+	}
+	slices.Sort(partitions)
+
+	ends, err := listOffsets(ctx, client, topic, partitions, kafka.LastOffsetOf)
+	if err != nil {
+		return nil, err
+	}
+
+	var starts map[int]int64
+	switch opts.From {
+	case ReplayFromEarliest:
+		starts, err = listOffsets(ctx, client, topic, partitions, kafka.FirstOffsetOf)
+	case ReplayFromTime:
+		starts, err = listOffsets(ctx, client, topic, partitions, func(p int) kafka.OffsetRequest {
+			return kafka.TimeOffsetOf(p, opts.Since)
+		})
+	case ReplayFromOffsets:
+		starts = opts.Offsets
+	default:
+		return nil, fmt.Errorf("unknown replay start %q", opts.From)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]partitionRange, 0, len(partitions))
+	for _, p := range partitions {
+		start, end := starts[p], ends[p]
+		// No message at or after the timestamp: nothing to replay.
+		if start < 0 || start > end {
+			start = end
+		}
+		out = append(out, partitionRange{partition: p, start: start, end: end})
+	}
+	return out, nil
+}
+
+func listOffsets(ctx context.Context, client *kafka.Client, topic string, partitions []int, req func(int) kafka.OffsetRequest) (map[int]int64, error) {
+	reqs := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		reqs[i] = req(p)
+	}
+	res, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: reqs}})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets: %w", err)
+	}
+
+	out := make(map[int]int64, len(partitions))
+	for _, po := range res.Topics[topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("list offsets of partition %d: %w", po.Partition, po.Error)
+		}
+		switch {
+		case po.FirstOffset >= 0:
+			out[po.Partition] = po.FirstOffset
+		case po.LastOffset >= 0:
+			out[po.Partition] = po.LastOffset
+		default:
+			out[po.Partition] = -1
+			for off := range po.Offsets {
+				out[po.Partition] = off
+			}
+		}
+	}
+	return out, nil
+}
+
+// commitGroupOffsets stores offsets as the next offsets group reads per partition.
+func commitGroupOffsets(ctx context.Context, client *kafka.Client, group, topic string, offsets map[int]int64) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for p, off := range offsets {
+		commits = append(commits, kafka.OffsetCommit{Partition: p, Offset: off})
+	}
+	res, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return err
+	}
+	for _, pr := range res.Topics[topic] {
+		if pr.Error != nil {
+			return fmt.Errorf("commit partition %d: %w", pr.Partition, pr.Error)
+		}
+	}
+	return nil
+}
+
+// partitionSource reads one partition until end (exclusive).
+type partitionSource struct {
+	reader interface {
+		FetchMessage(context.Context) (kafka.Message, error)
+		Close() error
+	}
+	end int64
+}
+
+// replayReader merges several partitionSources into one MessageReader and
+// reports errReplayDone once all of them are drained.
+type replayReader struct {
+	msgs    chan kafka.Message
+	cancel  context.CancelFunc
+	sources []partitionSource
+	commit  func(context.Context, map[int]int64) error
+	fetched atomic.Int64
+
+	errOnce sync.Once
+	err     error
+}
+
+func newReplayReader(ctx context.Context, sources []partitionSource, commit func(context.Context, map[int]int64) error) *replayReader {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &replayReader{
+		msgs:    make(chan kafka.Message),
+		cancel:  cancel,
+		sources: sources,
+		commit:  commit,
+	}
+
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src partitionSource) {
+			defer wg.Done()
+			for {
+				m, err := src.reader.FetchMessage(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						r.fail(err)
+					}
+					return
+				}
+				if m.Offset >= src.end {
+					return
+				}
+				select {
+				case r.msgs <- m:
+				case <-ctx.Done():
+					return
+				}
+				if m.Offset+1 >= src.end {
+					return
+				}
+			}
+		}(src)
+	}
+	go func() {
+		wg.Wait()
+		close(r.msgs)
+	}()
+	return r
+}
+
+func (r *replayReader) fail(err error) {
+	r.errOnce.Do(func() { r.err = err })
+	r.cancel()
+}
+
+func (r *replayReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m, ok := <-r.msgs:
+		if !ok {
+			if r.err != nil {
+				return kafka.Message{}, r.err
+			}
+			return kafka.Message{}, errReplayDone
+		}
+		r.fetched.Add(1)
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+// CommitMessages moves the consumer group past msgs, like a group reader does.
+func (r *replayReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	offsets := make(map[int]int64, len(msgs))
+	for _, m := range msgs {
+		offsets[m.Partition] = m.Offset + 1
+	}
+	return r.commit(ctx, offsets)
+}
+
+func (r *replayReader) Close() error {
+	r.cancel()
+	var errs []error
+	for _, src := range r.sources {
+		errs = append(errs, src.reader.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ParsePartitionOffsets parses a "partition:offset,..." list such as "0:120,1:98".
+func ParsePartitionOffsets(s string) (map[int]int64, error) {
+	out := make(map[int]int64)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ps, offs, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid partition offset %q, want partition:offset", part)
+		}
+		p, err := strconv.Atoi(ps)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid partition in %q", part)
+		}
+		off, err := strconv.ParseInt(offs, 10, 64)
+		if err != nil || off < 0 {
+			return nil, fmt.Errorf("invalid offset in %q", part)
+		}
+		out[p] = off
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no partition offsets given")
+	}
+	return out, nil
+}
+
+// dryRunRepo accepts every order without touching the database.
+type dryRunRepo struct{ repo.Repository }
+
+func (dryRunRepo) UpsertOrder(context.Context, repo.OrderWithRaw) (repo.UpsertStatus, error) {
+	return repo.Applied, nil
+}
+
+func (dryRunRepo) UpsertOrders(_ context.Context, orders []repo.OrderWithRaw) ([]repo.UpsertStatus, error) {
+	return make([]repo.UpsertStatus, len(orders)), nil
+}
+
+func (dryRunRepo) ApplyPatch(context.Context, repo.OrderPatch) (repo.UpsertStatus, []byte, error) {
+	return repo.Applied, nil, nil
+}
+
+func (dryRunRepo) DeleteOrder(context.Context, repo.OrderDeletion) (repo.UpsertStatus, error) {
+	return repo.Applied, nil
+}
+
+// discardCache drops everything; the replay tool serves no reads.
+type discardCache struct{}
+
+func (discardCache) Get(string) ([]byte, bool)            { return nil, false }
+func (discardCache) Set(string, []byte)                   {}
+func (discardCache) GetEntry(string) (*cache.Entry, bool) { return nil, false }
+func (discardCache) SetEntry(string, *cache.Entry)        {}
+func (discardCache) Delete(string)                        {}
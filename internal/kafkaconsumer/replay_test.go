@@ -0,0 +1,76 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/validation"
+)
+
+func TestReplay_StopsAtEndOffsetsAndCommitsProgress(t *testing.T) {
+	var sources []partitionSource
+	for p := 0; p < 2; p++ {
+		var msgs []kafka.Message
+		for off := 5; off < 10; off++ {
+			value := orderJSON(t, fmt.Sprintf("R%dO%d", p, off))
+			if p == 1 && off == 7 {
+				value = []byte("{broken")
+			}
+			msgs = append(msgs, kafka.Message{Topic: "orders", Partition: p, Offset: int64(off), Value: value})
+		}
+		sources = append(sources, partitionSource{reader: newReaderMock(msgs...), end: 10})
+	}
+
+	var mu sync.Mutex
+	committed := make(map[int]int64)
+	reader := newReplayReader(context.Background(), sources, func(_ context.Context, offsets map[int]int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for p, off := range offsets {
+			committed[p] = off
+		}
+		return nil
+	})
+	defer reader.Close()
+
+	p := &processor{
+		repo:      dryRunRepo{},
+		cache:     discardCache{},
+		validator: validation.New(),
+		workers:   2,
+	}
+	if err := replay(context.Background(), reader, p); err != nil {
+		t.Fatalf("replay returned error: %v", err)
+	}
+
+	if n := reader.fetched.Load(); n != 10 {
+		t.Fatalf("expected 10 messages, got %d", n)
+	}
+	if a, r := p.applied.Load(), p.rejected.Load(); a != 9 || r != 1 {
+		t.Fatalf("expected 9 applied and 1 rejected, got %d and %d", a, r)
+	}
+	if want := map[int]int64{0: 10, 1: 10}; !reflect.DeepEqual(committed, want) {
+		t.Fatalf("expected group at %v, got %v", want, committed)
+	}
+}
+
+func TestParsePartitionOffsets(t *testing.T) {
+	got, err := ParsePartitionOffsets("0:120, 1:98")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[int]int64{0: 120, 1: 98}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for _, s := range []string{"", "0", "a:1", "0:-1", "0:x"} {
+		if _, err := ParsePartitionOffsets(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
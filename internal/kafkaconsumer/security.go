@@ -0,0 +1,158 @@
+package kafkaconsumer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms accepted in Security.SASLMechanism.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// Security configures authentication and encryption of broker connections.
+// The zero value dials plain TCP.
+type Security struct {
+	// SASLMechanism is empty (no SASL), SASLPlain, SASLScramSHA256 or SASLScramSHA512.
+	SASLMechanism string
+	Username      string
+	Password      string
+	// TLS enables TLS; it is implied by any of the TLS fields below.
+	TLS bool
+	// CAFile is a PEM bundle trusted instead of the system roots.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables verification of the broker certificate.
+	InsecureSkipVerify bool
+}
+
+// String describes s for logs with the password redacted.
+func (s Security) String() string {
+	var parts []string
+	if s.SASLMechanism != "" {
+		pw := ""
+		if s.Password != "" {
+			pw = "***"
+		}
+		parts = append(parts, fmt.Sprintf("sasl=%s user=%s password=%s", s.SASLMechanism, s.Username, pw))
+	}
+	if s.tlsEnabled() {
+		parts = append(parts, fmt.Sprintf("tls=true ca=%s cert=%s key=%s insecure=%t", s.CAFile, s.CertFile, s.KeyFile, s.InsecureSkipVerify))
+	}
+	if len(parts) == 0 {
+		return "plaintext"
+	}
+	return strings.Join(parts, " ")
+}
+
+// tlsEnabled reports whether any TLS setting is given, so that a half-done
+// TLS configuration fails instead of silently dialing plain TCP.
+func (s Security) tlsEnabled() bool {
+	return s.TLS || s.CAFile != "" || s.CertFile != "" || s.KeyFile != "" || s.InsecureSkipVerify
+}
+
+func (s Security) mechanism() (sasl.Mechanism, error) {
+	if s.SASLMechanism == "" {
+		return nil, nil
+	}
+	if s.Username == "" {
+		return nil, fmt.Errorf("sasl %s: empty username", s.SASLMechanism)
+	}
+	switch strings.ToUpper(s.SASLMechanism) {
+	case SASLPlain:
+		return plain.Mechanism{Username: s.Username, Password: s.Password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, s.Username, s.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, s.Username, s.Password)
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism %q", s.SASLMechanism)
+	}
+}
+
+func (s Security) tlsConfig() (*tls.Config, error) {
+	if !s.tlsEnabled() {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	if s.CAFile != "" {
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka ca %s: no certificates found", s.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if s.CertFile != "" || s.KeyFile != "" {
+		if s.CertFile == "" || s.KeyFile == "" {
+			return nil, errors.New("kafka client certificate needs both cert and key files")
+		}
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// connectors holds the two ways kafka-go connects to brokers: Dialer for
+// readers and admin connections, Transport for writers and the Client API.
+type connectors struct {
+	dialer    *kafka.Dialer
+	transport *kafka.Transport
+}
+
+func (s Security) connectors() (connectors, error) {
+	mech, err := s.mechanism()
+	if err != nil {
+		return connectors{}, err
+	}
+	tlsCfg, err := s.tlsConfig()
+	if err != nil {
+		return connectors{}, err
+	}
+	return connectors{
+		dialer: &kafka.Dialer{
+			Timeout:       10 * time.Second,
+			DualStack:     true,
+			TLS:           tlsCfg,
+			SASLMechanism: mech,
+		},
+		transport: &kafka.Transport{
+			DialTimeout: 10 * time.Second,
+			TLS:         tlsCfg,
+			SASL:        mech,
+		},
+	}, nil
+}
+
+// NewWriter returns a writer to topic that connects with s and partitions
+// messages by key, as the dead-letter writers do.
+func NewWriter(brokers, topic string, s Security) (*kafka.Writer, error) {
+	conn, err := s.connectors()
+	if err != nil {
+		return nil, err
+	}
+	return newDLQWriter(brokers, topic, conn.transport), nil
+}
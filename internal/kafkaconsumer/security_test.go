@@ -0,0 +1,108 @@
+package kafkaconsumer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityString_RedactsPassword(t *testing.T) {
+	s := Security{SASLMechanism: SASLScramSHA512, Username: "orders", Password: "s3cr3t", CAFile: "/etc/kafka/ca.pem"}
+	got := s.String()
+	if strings.Contains(got, "s3cr3t") {
+		t.Fatalf("password leaked into %q", got)
+	}
+	if !strings.Contains(got, "sasl=SCRAM-SHA-512 user=orders password=***") || !strings.Contains(got, "tls=true ca=/etc/kafka/ca.pem") {
+		t.Fatalf("unexpected description %q", got)
+	}
+	if got := (Security{}).String(); got != "plaintext" {
+		t.Fatalf("expected plaintext, got %q", got)
+	}
+}
+
+func TestSecurityConnectors(t *testing.T) {
+	conn, err := Security{}.connectors()
+	if err != nil {
+		t.Fatalf("plaintext: %v", err)
+	}
+	if conn.dialer.TLS != nil || conn.dialer.SASLMechanism != nil || conn.transport.TLS != nil || conn.transport.SASL != nil {
+		t.Fatalf("expected plain connections")
+	}
+
+	for mech, name := range map[string]string{
+		SASLPlain:       "PLAIN",
+		SASLScramSHA256: "SCRAM-SHA-256",
+		"scram-sha-512": "SCRAM-SHA-512",
+	} {
+		conn, err := Security{SASLMechanism: mech, Username: "orders", Password: "pw"}.connectors()
+		if err != nil {
+			t.Fatalf("%s: %v", mech, err)
+		}
+		if conn.dialer.SASLMechanism.Name() != name || conn.transport.SASL.Name() != name {
+			t.Fatalf("%s: unexpected mechanism %s", mech, conn.dialer.SASLMechanism.Name())
+		}
+	}
+
+	ca := writeCA(t)
+	conn, err = Security{SASLMechanism: SASLScramSHA512, Username: "orders", Password: "pw", CAFile: ca}.connectors()
+	if err != nil {
+		t.Fatalf("tls: %v", err)
+	}
+	if conn.dialer.TLS == nil || conn.dialer.TLS.RootCAs == nil || conn.transport.TLS != conn.dialer.TLS {
+		t.Fatalf("expected dialer and transport to share the TLS config with the custom CA")
+	}
+
+	conn, err = Security{InsecureSkipVerify: true}.connectors()
+	if err != nil || conn.dialer.TLS == nil || !conn.dialer.TLS.InsecureSkipVerify {
+		t.Fatalf("expected InsecureSkipVerify to enable TLS, got %v", err)
+	}
+
+	bad := []Security{
+		{SASLMechanism: "GSSAPI", Username: "orders"},
+		{SASLMechanism: SASLPlain},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{TLS: true, CertFile: ca},
+		{CertFile: ca},
+		{KeyFile: ca},
+	}
+	for _, s := range bad {
+		if _, err := s.connectors(); err == nil {
+			t.Fatalf("expected error for %+v", s)
+		}
+	}
+}
+
+func writeCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
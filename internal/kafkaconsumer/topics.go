@@ -0,0 +1,237 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TopicSpec is how a topic is created when it does not exist yet.
+type TopicSpec struct {
+	// Partitions is the partition count; an existing topic with fewer
+	// partitions is grown to it. Zero means one partition.
+	Partitions int
+	// ReplicationFactor of a new topic; zero means one, -1 the broker default.
+	ReplicationFactor int
+	// Configs are topic-level settings of a new topic, e.g. retention.ms or
+	// cleanup.policy=compact. They are not changed on an existing topic; a
+	// mismatch is logged.
+	Configs map[string]string
+}
+
+// Provisioning controls topic management at startup.
+type Provisioning struct {
+	// Disabled leaves topics alone, for deployments without admin rights.
+	// The topics must then exist beforehand.
+	Disabled bool
+	// Topic is the spec of the orders topic.
+	Topic TopicSpec
+	// DLQ is the spec of the dead-letter and quarantine topics.
+	DLQ TopicSpec
+}
+
+// topicAdmin is the part of *kafka.Client used to manage topics. CreateTopics
+// and CreatePartitions are routed to the cluster controller by kafka-go.
+type topicAdmin interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error)
+	CreatePartitions(ctx context.Context, req *kafka.CreatePartitionsRequest) (*kafka.CreatePartitionsResponse, error)
+	DescribeConfigs(ctx context.Context, req *kafka.DescribeConfigsRequest) (*kafka.DescribeConfigsResponse, error)
+}
+
+// EnsureTopic provisions topic the way Run provisions its own topics, for
+// topics the service only produces to.
+func EnsureTopic(ctx context.Context, brokers string, s Security, topic string, spec TopicSpec) error {
+	conn, err := s.connectors()
+	if err != nil {
+		return err
+	}
+	admin := &kafka.Client{Addr: kafka.TCP(strings.Split(brokers, ",")...), Timeout: 10 * time.Second, Transport: conn.transport}
+	return ensureTopic(ctx, admin, topic, spec)
+}
+
+// ensureTopic makes sure topic exists with at least spec.Partitions
+// partitions, retrying while the cluster is unreachable.
+func ensureTopic(ctx context.Context, admin topicAdmin, topic string, spec TopicSpec) error {
+	retryCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var lastErr error
+	for {
+		err := provisionTopic(retryCtx, admin, topic, spec)
+		if err == nil {
+			return nil
+		}
+		if !retryableTopicError(err) {
+			return fmt.Errorf("provision topic %s: %w", topic, err)
+		}
+		lastErr = err
+		select {
+		case <-retryCtx.Done():
+			return fmt.Errorf("provision topic %s: %w", topic, lastErr)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func provisionTopic(ctx context.Context, admin topicAdmin, topic string, spec TopicSpec) error {
+	partitions := max(spec.Partitions, 1)
+
+	md, err := admin.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return err
+	}
+	existing := -1
+	for _, t := range md.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil && !errors.Is(t.Error, kafka.UnknownTopicOrPartition) {
+			return t.Error
+		}
+		if t.Error == nil {
+			existing = len(t.Partitions)
+		}
+	}
+
+	if existing < 0 {
+		rf := spec.ReplicationFactor
+		if rf == 0 {
+			rf = 1
+		}
+		res, err := admin.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: []kafka.TopicConfig{{
+			Topic:             topic,
+			NumPartitions:     partitions,
+			ReplicationFactor: rf,
+			ConfigEntries:     configEntries(spec.Configs),
+		}}})
+		if err == nil {
+			err = res.Errors[topic]
+		}
+		if err != nil {
+			// TopicAlreadyExists means a concurrent create; it is retried and
+			// the partition count checked on the next attempt.
+			return err
+		}
+		log.Printf("created topic %s (partitions=%d replication_factor=%d configs=%v) via controller %d",
+			topic, partitions, rf, spec.Configs, md.Controller.ID)
+		return nil
+	}
+
+	if len(spec.Configs) > 0 {
+		drift, err := topicConfigDrift(ctx, admin, topic, spec.Configs)
+		switch {
+		case err != nil:
+			log.Printf("topic %s: cannot check configs: %v", topic, err)
+		case len(drift) > 0:
+			log.Printf("topic %s warn: configs differ from the spec and are left as they are: %s",
+				topic, strings.Join(drift, ", "))
+		}
+	}
+
+	if existing >= partitions {
+		return nil
+	}
+	res, err := admin.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{Topics: []kafka.TopicPartitionsConfig{{
+		Name:  topic,
+		Count: int32(partitions),
+	}}})
+	if err == nil {
+		err = res.Errors[topic]
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("grew topic %s from %d to %d partitions via controller %d", topic, existing, partitions, md.Controller.ID)
+	return nil
+}
+
+// topicConfigDrift describes the configs of topic that differ from want as
+// "name=actual (want value)", sorted by name.
+func topicConfigDrift(ctx context.Context, admin topicAdmin, topic string, want map[string]string) ([]string, error) {
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res, err := admin.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: []kafka.DescribeConfigRequestResource{{
+		ResourceType: kafka.ResourceTypeTopic,
+		ResourceName: topic,
+		ConfigNames:  names,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	actual := make(map[string]string, len(names))
+	for _, r := range res.Resources {
+		if r.ResourceName != topic {
+			continue
+		}
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		for _, e := range r.ConfigEntries {
+			actual[e.ConfigName] = e.ConfigValue
+		}
+	}
+	var drift []string
+	for _, name := range names {
+		got, ok := actual[name]
+		if !ok {
+			got = "<unknown>"
+		}
+		if got != want[name] {
+			drift = append(drift, fmt.Sprintf("%s=%s (want %s)", name, got, want[name]))
+		}
+	}
+	return drift, nil
+}
+
+// retryableTopicError reports whether provisioning may succeed on a later
+// attempt: the cluster is unreachable, electing a controller or the topic is
+// being created concurrently.
+func retryableTopicError(err error) bool {
+	var kerr kafka.Error
+	if errors.As(err, &kerr) {
+		return kerr.Temporary() || kerr == kafka.TopicAlreadyExists || kerr == kafka.NotController
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+func configEntries(configs map[string]string) []kafka.ConfigEntry {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]kafka.ConfigEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, kafka.ConfigEntry{ConfigName: name, ConfigValue: configs[name]})
+	}
+	return entries
+}
+
+// ParseTopicConfigs parses "name=value,..." topic settings, e.g.
+// "retention.ms=604800000,cleanup.policy=compact".
+func ParseTopicConfigs(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid topic config %q, want name=value", pair)
+		}
+		out[name] = strings.TrimSpace(value)
+	}
+	return out, nil
+}
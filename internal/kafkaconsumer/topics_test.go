@@ -0,0 +1,144 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeAdmin is a single-topic cluster whose controller is broker 2.
+type fakeAdmin struct {
+	partitions int // -1: topic does not exist
+	created    []kafka.TopicConfig
+	grownTo    []int32
+	createErr  error
+	configs    map[string]string
+}
+
+func (f *fakeAdmin) Metadata(_ context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	t := kafka.Topic{Name: req.Topics[0]}
+	if f.partitions < 0 {
+		t.Error = kafka.UnknownTopicOrPartition
+	}
+	for i := 0; i < f.partitions; i++ {
+		t.Partitions = append(t.Partitions, kafka.Partition{Topic: t.Name, ID: i})
+	}
+	return &kafka.MetadataResponse{Controller: kafka.Broker{ID: 2}, Topics: []kafka.Topic{t}}, nil
+}
+
+func (f *fakeAdmin) CreateTopics(_ context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error) {
+	t := req.Topics[0]
+	if err := f.createErr; err != nil {
+		f.createErr = nil
+		f.partitions = 1
+		return &kafka.CreateTopicsResponse{Errors: map[string]error{t.Topic: err}}, nil
+	}
+	f.created = append(f.created, t)
+	f.partitions = t.NumPartitions
+	return &kafka.CreateTopicsResponse{Errors: map[string]error{}}, nil
+}
+
+func (f *fakeAdmin) CreatePartitions(_ context.Context, req *kafka.CreatePartitionsRequest) (*kafka.CreatePartitionsResponse, error) {
+	f.grownTo = append(f.grownTo, req.Topics[0].Count)
+	f.partitions = int(req.Topics[0].Count)
+	return &kafka.CreatePartitionsResponse{Errors: map[string]error{}}, nil
+}
+
+func (f *fakeAdmin) DescribeConfigs(_ context.Context, req *kafka.DescribeConfigsRequest) (*kafka.DescribeConfigsResponse, error) {
+	r := kafka.DescribeConfigResponseResource{ResourceName: req.Resources[0].ResourceName}
+	for _, name := range req.Resources[0].ConfigNames {
+		if v, ok := f.configs[name]; ok {
+			r.ConfigEntries = append(r.ConfigEntries, kafka.DescribeConfigResponseConfigEntry{ConfigName: name, ConfigValue: v})
+		}
+	}
+	return &kafka.DescribeConfigsResponse{Resources: []kafka.DescribeConfigResponseResource{r}}, nil
+}
+
+func TestEnsureTopic_CreatesWithSpec(t *testing.T) {
+	admin := &fakeAdmin{partitions: -1}
+	spec := TopicSpec{Partitions: 6, ReplicationFactor: 3, Configs: map[string]string{"retention.ms": "604800000", "cleanup.policy": "compact"}}
+
+	if err := ensureTopic(context.Background(), admin, "orders", spec); err != nil {
+		t.Fatalf("ensureTopic: %v", err)
+	}
+	if len(admin.created) != 1 {
+		t.Fatalf("expected one create, got %d", len(admin.created))
+	}
+	got := admin.created[0]
+	want := []kafka.ConfigEntry{{ConfigName: "cleanup.policy", ConfigValue: "compact"}, {ConfigName: "retention.ms", ConfigValue: "604800000"}}
+	if got.Topic != "orders" || got.NumPartitions != 6 || got.ReplicationFactor != 3 || !reflect.DeepEqual(got.ConfigEntries, want) {
+		t.Fatalf("unexpected topic config %+v", got)
+	}
+}
+
+func TestEnsureTopic_GrowsPartitionsButNeverShrinks(t *testing.T) {
+	admin := &fakeAdmin{partitions: 2}
+	if err := ensureTopic(context.Background(), admin, "orders", TopicSpec{Partitions: 8}); err != nil {
+		t.Fatalf("ensureTopic: %v", err)
+	}
+	if !reflect.DeepEqual(admin.grownTo, []int32{8}) || len(admin.created) != 0 {
+		t.Fatalf("expected growth to 8 partitions, got grown=%v created=%d", admin.grownTo, len(admin.created))
+	}
+
+	if err := ensureTopic(context.Background(), admin, "orders", TopicSpec{Partitions: 4}); err != nil {
+		t.Fatalf("ensureTopic: %v", err)
+	}
+	if len(admin.grownTo) != 1 {
+		t.Fatalf("expected no further changes, got %v", admin.grownTo)
+	}
+}
+
+func TestEnsureTopic_ConcurrentCreateIsRetried(t *testing.T) {
+	admin := &fakeAdmin{partitions: -1, createErr: kafka.TopicAlreadyExists}
+	if err := ensureTopic(context.Background(), admin, "orders", TopicSpec{Partitions: 3}); err != nil {
+		t.Fatalf("ensureTopic: %v", err)
+	}
+	if !reflect.DeepEqual(admin.grownTo, []int32{3}) {
+		t.Fatalf("expected the concurrently created topic to be grown to 3, got %v", admin.grownTo)
+	}
+}
+
+func TestEnsureTopic_PermanentErrorFailsFast(t *testing.T) {
+	admin := &fakeAdmin{partitions: -1, createErr: kafka.TopicAuthorizationFailed}
+	err := ensureTopic(context.Background(), admin, "orders", TopicSpec{})
+	if err == nil || len(admin.created) != 0 {
+		t.Fatalf("expected authorization error, got %v", err)
+	}
+}
+
+func TestTopicConfigDrift(t *testing.T) {
+	admin := &fakeAdmin{partitions: 3, configs: map[string]string{"cleanup.policy": "delete", "retention.ms": "604800000"}}
+	want := map[string]string{"cleanup.policy": "compact", "retention.ms": "604800000", "segment.ms": "3600000"}
+
+	drift, err := topicConfigDrift(context.Background(), admin, "orders", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"cleanup.policy=delete (want compact)", "segment.ms=<unknown> (want 3600000)"}; !reflect.DeepEqual(drift, exp) {
+		t.Fatalf("expected drift %v, got %v", exp, drift)
+	}
+
+	// An existing topic is only checked, never altered.
+	if err := ensureTopic(context.Background(), admin, "orders", TopicSpec{Partitions: 3, Configs: want}); err != nil {
+		t.Fatalf("ensureTopic: %v", err)
+	}
+	if len(admin.created) != 0 || len(admin.grownTo) != 0 {
+		t.Fatalf("expected the existing topic to be left alone")
+	}
+}
+
+func TestParseTopicConfigs(t *testing.T) {
+	got, err := ParseTopicConfigs(" retention.ms=86400000, cleanup.policy=compact ,")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := map[string]string{"retention.ms": "86400000", "cleanup.policy": "compact"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if _, err := ParseTopicConfigs("retention.ms"); err == nil {
+		t.Fatalf("expected error for a setting without value")
+	}
+}
@@ -0,0 +1,49 @@
+package kafkaconsumer
+
+import (
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// HeaderOrderVersion carries an explicit order version set by the producer.
+const HeaderOrderVersion = "x-order-version"
+
+// Where the version used for out-of-order protection is taken from.
+const (
+	VersionFromTimestamp = "timestamp"
+	VersionFromHeader    = "header"
+	VersionFromPayload   = "payload"
+)
+
+// orderVersion picks the version of an event according to source; payload is
+// the version carried in the message body, zero when absent. When the chosen
+// source is missing it falls back to the message timestamp in microseconds.
+func orderVersion(source string, m kafka.Message, payload int64) int64 {
+	switch source {
+	case VersionFromHeader:
+		if h, ok := headerValue(m, HeaderOrderVersion); ok {
+			if v, err := strconv.ParseInt(h, 10, 64); err == nil {
+				return v
+			}
+		}
+	case VersionFromPayload:
+		if payload > 0 {
+			return payload
+		}
+	}
+	if m.Time.IsZero() {
+		return 0
+	}
+	return m.Time.UnixMicro()
+}
+
+// headerValue returns the last value of header key in m.
+func headerValue(m kafka.Message, key string) (string, bool) {
+	for i := len(m.Headers) - 1; i >= 0; i-- {
+		if m.Headers[i].Key == key {
+			return string(m.Headers[i].Value), true
+		}
+	}
+	return "", false
+}
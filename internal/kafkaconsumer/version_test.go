@@ -0,0 +1,37 @@
+package kafkaconsumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOrderVersionSources(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := kafka.Message{
+		Time:    ts,
+		Headers: []kafka.Header{{Key: HeaderOrderVersion, Value: []byte("42")}},
+	}
+
+	cases := []struct {
+		name    string
+		source  string
+		msg     kafka.Message
+		payload int64
+		want    int64
+	}{
+		{"timestamp", VersionFromTimestamp, m, 9, ts.UnixMicro()},
+		{"header", VersionFromHeader, m, 9, 42},
+		{"payload", VersionFromPayload, m, 9, 9},
+		{"missing header falls back to timestamp", VersionFromHeader, kafka.Message{Time: ts}, 9, ts.UnixMicro()},
+		{"missing payload version falls back to timestamp", VersionFromPayload, m, 0, ts.UnixMicro()},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := orderVersion(tc.source, tc.msg, tc.payload); got != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
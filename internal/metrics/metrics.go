@@ -0,0 +1,165 @@
+// Package metrics exposes the service instrumentation in Prometheus format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/cache"
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/kafkaconsumer"
+)
+
+// Metrics implements the consumer, cache and HTTP observers on top of a
+// dedicated Prometheus registry.
+type Metrics struct {
+	reg *prometheus.Registry
+
+	consumed      *prometheus.CounterVec
+	skipped       *prometheus.CounterVec
+	upsertFailed  prometheus.Counter
+	upsertLatency *prometheus.HistogramVec
+	partitionLag  *prometheus.GaugeVec
+
+	readerLag        prometheus.Gauge
+	readerMessages   prometheus.Counter
+	readerErrors     prometheus.Counter
+	readerRebalances prometheus.Counter
+
+	cacheHits      prometheus.Counter
+	cacheMisses    prometheus.Counter
+	cacheEvictions prometheus.Counter
+
+	httpLatency  *prometheus.HistogramVec
+	authFailures *prometheus.CounterVec
+}
+
+var (
+	_ kafkaconsumer.Metrics = (*Metrics)(nil)
+	_ httpapi.Observer      = (*Metrics)(nil)
+	_ httpapi.AuthObserver  = (*Metrics)(nil)
+)
+
+func New() *Metrics {
+	m := &Metrics{
+		reg: prometheus.NewRegistry(),
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "orders_consumer_messages_total",
+			Help: "Messages fetched from Kafka.",
+		}, []string{"topic", "partition"}),
+		skipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "orders_consumer_messages_skipped_total",
+			Help: "Messages parked in the DLQ or quarantine, by reason.",
+		}, []string{"reason"}),
+		upsertFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "orders_consumer_upsert_failures_total",
+			Help: "Writes that failed after all retries.",
+		}),
+		upsertLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "orders_consumer_upsert_duration_seconds",
+			Help:    "Duration of repository writes.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"kind"}),
+		partitionLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "orders_consumer_partition_lag",
+			Help: "Messages between the last fetched offset and the high-water mark.",
+		}, []string{"topic", "partition"}),
+		readerLag: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "orders_kafka_reader_lag",
+			Help: "Lag reported by the kafka-go reader stats.",
+		}),
+		readerMessages: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "orders_kafka_reader_messages_total",
+			Help: "Messages read according to the kafka-go reader stats.",
+		}),
+		readerErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "orders_kafka_reader_errors_total",
+			Help: "Errors reported by the kafka-go reader stats.",
+		}),
+		readerRebalances: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "orders_kafka_reader_rebalances_total",
+			Help: "Consumer group rebalances reported by the kafka-go reader stats.",
+		}),
+		cacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "orders_cache_hits_total",
+			Help: "Cache lookups that found the order.",
+		}),
+		cacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "orders_cache_misses_total",
+			Help: "Cache lookups that missed.",
+		}),
+		cacheEvictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "orders_cache_evictions_total",
+			Help: "Orders evicted from the LRU cache.",
+		}),
+		httpLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "orders_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "code"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "orders_http_auth_failures_total",
+			Help: "HTTP requests rejected by authentication or scope checks.",
+		}, []string{"method", "reason"}),
+	}
+	m.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.consumed, m.skipped, m.upsertFailed, m.upsertLatency, m.partitionLag,
+		m.readerLag, m.readerMessages, m.readerErrors, m.readerRebalances,
+		m.cacheHits, m.cacheMisses, m.cacheEvictions,
+		m.httpLatency, m.authFailures,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) MessageConsumed(topic string, partition int, lag int64) {
+	p := strconv.Itoa(partition)
+	m.consumed.WithLabelValues(topic, p).Inc()
+	m.partitionLag.WithLabelValues(topic, p).Set(float64(lag))
+}
+
+func (m *Metrics) MessageSkipped(reason string) { m.skipped.WithLabelValues(reason).Inc() }
+
+func (m *Metrics) UpsertFailed() { m.upsertFailed.Inc() }
+
+func (m *Metrics) ObserveUpsert(kind string, d time.Duration) {
+	m.upsertLatency.WithLabelValues(kind).Observe(d.Seconds())
+}
+
+// ObserveReader records reader stats; their counters are deltas since the
+// previous call.
+func (m *Metrics) ObserveReader(s kafka.ReaderStats) {
+	m.readerLag.Set(float64(s.Lag))
+	m.readerMessages.Add(float64(s.Messages))
+	m.readerErrors.Add(float64(s.Errors))
+	m.readerRebalances.Add(float64(s.Rebalances))
+}
+
+func (m *Metrics) ObserveRequest(route string, status int, d time.Duration) {
+	m.httpLatency.WithLabelValues(route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+func (m *Metrics) AuthFailed(method, reason string) {
+	m.authFailures.WithLabelValues(method, reason).Inc()
+}
+
+// Cache returns an observer that counts cache hits, misses and evictions.
+func (m *Metrics) Cache() cache.Observer { return cacheObserver{m} }
+
+type cacheObserver struct{ m *Metrics }
+
+func (o cacheObserver) Hit()     { o.m.cacheHits.Inc() }
+func (o cacheObserver) Miss()    { o.m.cacheMisses.Inc() }
+func (o cacheObserver) Evicted() { o.m.cacheEvictions.Inc() }
@@ -18,12 +18,21 @@ var _ cache.Store = &StoreMock{}
 //
 //		// make and configure a mocked cache.Store
 //		mockedStore := &StoreMock{
+//			DeleteFunc: func(id string)  {
+//				panic("mock out the Delete method")
+//			},
 //			GetFunc: func(id string) ([]byte, bool) {
 //				panic("mock out the Get method")
 //			},
+//			GetEntryFunc: func(id string) (*cache.Entry, bool) {
+//				panic("mock out the GetEntry method")
+//			},
 //			SetFunc: func(id string, b []byte)  {
 //				panic("mock out the Set method")
 //			},
+//			SetEntryFunc: func(id string, e *cache.Entry)  {
+//				panic("mock out the SetEntry method")
+//			},
 //		}
 //
 //		// use mockedStore in code that requires cache.Store
@@ -31,19 +40,38 @@ var _ cache.Store = &StoreMock{}
 //
 //	}
 type StoreMock struct {
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(id string)
+
 	// GetFunc mocks the Get method.
 	GetFunc func(id string) ([]byte, bool)
 
+	// GetEntryFunc mocks the GetEntry method.
+	GetEntryFunc func(id string) (*cache.Entry, bool)
+
 	// SetFunc mocks the Set method.
 	SetFunc func(id string, b []byte)
 
+	// SetEntryFunc mocks the SetEntry method.
+	SetEntryFunc func(id string, e *cache.Entry)
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ID is the id argument value.
+			ID string
+		}
 		// Get holds details about calls to the Get method.
 		Get []struct {
 			// ID is the id argument value.
 			ID string
 		}
+		// GetEntry holds details about calls to the GetEntry method.
+		GetEntry []struct {
+			// ID is the id argument value.
+			ID string
+		}
 		// Set holds details about calls to the Set method.
 		Set []struct {
 			// ID is the id argument value.
@@ -51,9 +79,51 @@ type StoreMock struct {
 			// B is the b argument value.
 			B []byte
 		}
+		// SetEntry holds details about calls to the SetEntry method.
+		SetEntry []struct {
+			// ID is the id argument value.
+			ID string
+			// E is the e argument value.
+			E *cache.Entry
+		}
 	}
-	lockGet sync.RWMutex
-	lockSet sync.RWMutex
+	lockDelete   sync.RWMutex
+	lockGet      sync.RWMutex
+	lockGetEntry sync.RWMutex
+	lockSet      sync.RWMutex
+	lockSetEntry sync.RWMutex
+}
+
+// Delete calls DeleteFunc.
+func (mock *StoreMock) Delete(id string) {
+	if mock.DeleteFunc == nil {
+		panic("StoreMock.DeleteFunc: method is nil but Store.Delete was just called")
+	}
+	callInfo := struct {
+		ID string
+	}{
+		ID: id,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	mock.DeleteFunc(id)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedStore.DeleteCalls())
+func (mock *StoreMock) DeleteCalls() []struct {
+	ID string
+} {
+	var calls []struct {
+		ID string
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
 }
 
 // Get calls GetFunc.
@@ -88,6 +158,38 @@ func (mock *StoreMock) GetCalls() []struct {
 	return calls
 }
 
+// GetEntry calls GetEntryFunc.
+func (mock *StoreMock) GetEntry(id string) (*cache.Entry, bool) {
+	if mock.GetEntryFunc == nil {
+		panic("StoreMock.GetEntryFunc: method is nil but Store.GetEntry was just called")
+	}
+	callInfo := struct {
+		ID string
+	}{
+		ID: id,
+	}
+	mock.lockGetEntry.Lock()
+	mock.calls.GetEntry = append(mock.calls.GetEntry, callInfo)
+	mock.lockGetEntry.Unlock()
+	return mock.GetEntryFunc(id)
+}
+
+// GetEntryCalls gets all the calls that were made to GetEntry.
+// Check the length with:
+//
+//	len(mockedStore.GetEntryCalls())
+func (mock *StoreMock) GetEntryCalls() []struct {
+	ID string
+} {
+	var calls []struct {
+		ID string
+	}
+	mock.lockGetEntry.RLock()
+	calls = mock.calls.GetEntry
+	mock.lockGetEntry.RUnlock()
+	return calls
+}
+
 // Set calls SetFunc.
 func (mock *StoreMock) Set(id string, b []byte) {
 	if mock.SetFunc == nil {
@@ -123,3 +225,39 @@ func (mock *StoreMock) SetCalls() []struct {
 	mock.lockSet.RUnlock()
 	return calls
 }
+
+// SetEntry calls SetEntryFunc.
+func (mock *StoreMock) SetEntry(id string, e *cache.Entry) {
+	if mock.SetEntryFunc == nil {
+		panic("StoreMock.SetEntryFunc: method is nil but Store.SetEntry was just called")
+	}
+	callInfo := struct {
+		ID string
+		E  *cache.Entry
+	}{
+		ID: id,
+		E:  e,
+	}
+	mock.lockSetEntry.Lock()
+	mock.calls.SetEntry = append(mock.calls.SetEntry, callInfo)
+	mock.lockSetEntry.Unlock()
+	mock.SetEntryFunc(id, e)
+}
+
+// SetEntryCalls gets all the calls that were made to SetEntry.
+// Check the length with:
+//
+//	len(mockedStore.SetEntryCalls())
+func (mock *StoreMock) SetEntryCalls() []struct {
+	ID string
+	E  *cache.Entry
+} {
+	var calls []struct {
+		ID string
+		E  *cache.Entry
+	}
+	mock.lockSetEntry.RLock()
+	calls = mock.calls.SetEntry
+	mock.lockSetEntry.RUnlock()
+	return calls
+}
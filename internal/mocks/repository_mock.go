@@ -5,9 +5,9 @@ package mocks
 
 import (
 	"context"
-	"github.com/kosovrzn/wb-tech-l0/internal/domain"
 	"github.com/kosovrzn/wb-tech-l0/internal/repo"
 	"sync"
+	"time"
 )
 
 // Ensure, that RepositoryMock does implement repo.Repository.
@@ -20,13 +20,34 @@ var _ repo.Repository = &RepositoryMock{}
 //
 //		// make and configure a mocked repo.Repository
 //		mockedRepository := &RepositoryMock{
-//			GetOrderRawFunc: func(ctx context.Context, id string) ([]byte, error) {
+//			ApplyPatchFunc: func(ctx context.Context, rec repo.OrderPatch) (repo.UpsertStatus, []byte, error) {
+//				panic("mock out the ApplyPatch method")
+//			},
+//			DeleteOrderFunc: func(ctx context.Context, rec repo.OrderDeletion) (repo.UpsertStatus, error) {
+//				panic("mock out the DeleteOrder method")
+//			},
+//			GetOrderRawFunc: func(ctx context.Context, id string) (repo.StoredOrder, error) {
 //				panic("mock out the GetOrderRaw method")
 //			},
-//			UpsertOrderFunc: func(ctx context.Context, o *domain.Order, rawJSON []byte) error {
+//			GetOrdersRawFunc: func(ctx context.Context, ids []string) (map[string]repo.StoredOrder, error) {
+//				panic("mock out the GetOrdersRaw method")
+//			},
+//			ListOrdersFunc: func(ctx context.Context, f repo.OrderFilter, after *repo.OrderCursor, limit int) (repo.OrderPage, error) {
+//				panic("mock out the ListOrders method")
+//			},
+//			LookupOrderUIDFunc: func(ctx context.Context, key repo.LookupKey, value string) (string, error) {
+//				panic("mock out the LookupOrderUID method")
+//			},
+//			PruneLedgerFunc: func(ctx context.Context, olderThan time.Time) (int64, error) {
+//				panic("mock out the PruneLedger method")
+//			},
+//			UpsertOrderFunc: func(ctx context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
 //				panic("mock out the UpsertOrder method")
 //			},
-//			WarmupFunc: func(ctx context.Context, limit int) (map[string][]byte, error) {
+//			UpsertOrdersFunc: func(ctx context.Context, orders []repo.OrderWithRaw) ([]repo.UpsertStatus, error) {
+//				panic("mock out the UpsertOrders method")
+//			},
+//			WarmupFunc: func(ctx context.Context, limit int) (map[string]repo.StoredOrder, error) {
 //				panic("mock out the Warmup method")
 //			},
 //		}
@@ -36,17 +57,52 @@ var _ repo.Repository = &RepositoryMock{}
 //
 //	}
 type RepositoryMock struct {
+	// ApplyPatchFunc mocks the ApplyPatch method.
+	ApplyPatchFunc func(ctx context.Context, rec repo.OrderPatch) (repo.UpsertStatus, []byte, error)
+
+	// DeleteOrderFunc mocks the DeleteOrder method.
+	DeleteOrderFunc func(ctx context.Context, rec repo.OrderDeletion) (repo.UpsertStatus, error)
+
 	// GetOrderRawFunc mocks the GetOrderRaw method.
-	GetOrderRawFunc func(ctx context.Context, id string) ([]byte, error)
+	GetOrderRawFunc func(ctx context.Context, id string) (repo.StoredOrder, error)
+
+	// GetOrdersRawFunc mocks the GetOrdersRaw method.
+	GetOrdersRawFunc func(ctx context.Context, ids []string) (map[string]repo.StoredOrder, error)
+
+	// ListOrdersFunc mocks the ListOrders method.
+	ListOrdersFunc func(ctx context.Context, f repo.OrderFilter, after *repo.OrderCursor, limit int) (repo.OrderPage, error)
+
+	// LookupOrderUIDFunc mocks the LookupOrderUID method.
+	LookupOrderUIDFunc func(ctx context.Context, key repo.LookupKey, value string) (string, error)
+
+	// PruneLedgerFunc mocks the PruneLedger method.
+	PruneLedgerFunc func(ctx context.Context, olderThan time.Time) (int64, error)
 
 	// UpsertOrderFunc mocks the UpsertOrder method.
-	UpsertOrderFunc func(ctx context.Context, o *domain.Order, rawJSON []byte) error
+	UpsertOrderFunc func(ctx context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error)
+
+	// UpsertOrdersFunc mocks the UpsertOrders method.
+	UpsertOrdersFunc func(ctx context.Context, orders []repo.OrderWithRaw) ([]repo.UpsertStatus, error)
 
 	// WarmupFunc mocks the Warmup method.
-	WarmupFunc func(ctx context.Context, limit int) (map[string][]byte, error)
+	WarmupFunc func(ctx context.Context, limit int) (map[string]repo.StoredOrder, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// ApplyPatch holds details about calls to the ApplyPatch method.
+		ApplyPatch []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Rec is the rec argument value.
+			Rec repo.OrderPatch
+		}
+		// DeleteOrder holds details about calls to the DeleteOrder method.
+		DeleteOrder []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Rec is the rec argument value.
+			Rec repo.OrderDeletion
+		}
 		// GetOrderRaw holds details about calls to the GetOrderRaw method.
 		GetOrderRaw []struct {
 			// Ctx is the ctx argument value.
@@ -54,14 +110,53 @@ type RepositoryMock struct {
 			// ID is the id argument value.
 			ID string
 		}
+		// GetOrdersRaw holds details about calls to the GetOrdersRaw method.
+		GetOrdersRaw []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// IDs is the ids argument value.
+			IDs []string
+		}
+		// ListOrders holds details about calls to the ListOrders method.
+		ListOrders []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// F is the f argument value.
+			F repo.OrderFilter
+			// After is the after argument value.
+			After *repo.OrderCursor
+			// Limit is the limit argument value.
+			Limit int
+		}
+		// LookupOrderUID holds details about calls to the LookupOrderUID method.
+		LookupOrderUID []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Key is the key argument value.
+			Key repo.LookupKey
+			// Value is the value argument value.
+			Value string
+		}
+		// PruneLedger holds details about calls to the PruneLedger method.
+		PruneLedger []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// OlderThan is the olderThan argument value.
+			OlderThan time.Time
+		}
 		// UpsertOrder holds details about calls to the UpsertOrder method.
 		UpsertOrder []struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
-			// O is the o argument value.
-			O *domain.Order
-			// RawJSON is the rawJSON argument value.
-			RawJSON []byte
+			// Rec is the rec argument value.
+			Rec repo.OrderWithRaw
+		}
+		// UpsertOrders holds details about calls to the UpsertOrders method.
+		UpsertOrders []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Orders is the orders argument value.
+			Orders []repo.OrderWithRaw
 		}
 		// Warmup holds details about calls to the Warmup method.
 		Warmup []struct {
@@ -71,13 +166,92 @@ type RepositoryMock struct {
 			Limit int
 		}
 	}
-	lockGetOrderRaw sync.RWMutex
-	lockUpsertOrder sync.RWMutex
-	lockWarmup      sync.RWMutex
+	lockApplyPatch     sync.RWMutex
+	lockDeleteOrder    sync.RWMutex
+	lockGetOrderRaw    sync.RWMutex
+	lockGetOrdersRaw   sync.RWMutex
+	lockListOrders     sync.RWMutex
+	lockLookupOrderUID sync.RWMutex
+	lockPruneLedger    sync.RWMutex
+	lockUpsertOrder    sync.RWMutex
+	lockUpsertOrders   sync.RWMutex
+	lockWarmup         sync.RWMutex
+}
+
+// ApplyPatch calls ApplyPatchFunc.
+func (mock *RepositoryMock) ApplyPatch(ctx context.Context, rec repo.OrderPatch) (repo.UpsertStatus, []byte, error) {
+	if mock.ApplyPatchFunc == nil {
+		panic("RepositoryMock.ApplyPatchFunc: method is nil but Repository.ApplyPatch was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		Rec repo.OrderPatch
+	}{
+		Ctx: ctx,
+		Rec: rec,
+	}
+	mock.lockApplyPatch.Lock()
+	mock.calls.ApplyPatch = append(mock.calls.ApplyPatch, callInfo)
+	mock.lockApplyPatch.Unlock()
+	return mock.ApplyPatchFunc(ctx, rec)
+}
+
+// ApplyPatchCalls gets all the calls that were made to ApplyPatch.
+// Check the length with:
+//
+//	len(mockedRepository.ApplyPatchCalls())
+func (mock *RepositoryMock) ApplyPatchCalls() []struct {
+	Ctx context.Context
+	Rec repo.OrderPatch
+} {
+	var calls []struct {
+		Ctx context.Context
+		Rec repo.OrderPatch
+	}
+	mock.lockApplyPatch.RLock()
+	calls = mock.calls.ApplyPatch
+	mock.lockApplyPatch.RUnlock()
+	return calls
+}
+
+// DeleteOrder calls DeleteOrderFunc.
+func (mock *RepositoryMock) DeleteOrder(ctx context.Context, rec repo.OrderDeletion) (repo.UpsertStatus, error) {
+	if mock.DeleteOrderFunc == nil {
+		panic("RepositoryMock.DeleteOrderFunc: method is nil but Repository.DeleteOrder was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		Rec repo.OrderDeletion
+	}{
+		Ctx: ctx,
+		Rec: rec,
+	}
+	mock.lockDeleteOrder.Lock()
+	mock.calls.DeleteOrder = append(mock.calls.DeleteOrder, callInfo)
+	mock.lockDeleteOrder.Unlock()
+	return mock.DeleteOrderFunc(ctx, rec)
+}
+
+// DeleteOrderCalls gets all the calls that were made to DeleteOrder.
+// Check the length with:
+//
+//	len(mockedRepository.DeleteOrderCalls())
+func (mock *RepositoryMock) DeleteOrderCalls() []struct {
+	Ctx context.Context
+	Rec repo.OrderDeletion
+} {
+	var calls []struct {
+		Ctx context.Context
+		Rec repo.OrderDeletion
+	}
+	mock.lockDeleteOrder.RLock()
+	calls = mock.calls.DeleteOrder
+	mock.lockDeleteOrder.RUnlock()
+	return calls
 }
 
 // GetOrderRaw calls GetOrderRawFunc.
-func (mock *RepositoryMock) GetOrderRaw(ctx context.Context, id string) ([]byte, error) {
+func (mock *RepositoryMock) GetOrderRaw(ctx context.Context, id string) (repo.StoredOrder, error) {
 	if mock.GetOrderRawFunc == nil {
 		panic("RepositoryMock.GetOrderRawFunc: method is nil but Repository.GetOrderRaw was just called")
 	}
@@ -112,24 +286,178 @@ func (mock *RepositoryMock) GetOrderRawCalls() []struct {
 	return calls
 }
 
+// GetOrdersRaw calls GetOrdersRawFunc.
+func (mock *RepositoryMock) GetOrdersRaw(ctx context.Context, ids []string) (map[string]repo.StoredOrder, error) {
+	if mock.GetOrdersRawFunc == nil {
+		panic("RepositoryMock.GetOrdersRawFunc: method is nil but Repository.GetOrdersRaw was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		IDs []string
+	}{
+		Ctx: ctx,
+		IDs: ids,
+	}
+	mock.lockGetOrdersRaw.Lock()
+	mock.calls.GetOrdersRaw = append(mock.calls.GetOrdersRaw, callInfo)
+	mock.lockGetOrdersRaw.Unlock()
+	return mock.GetOrdersRawFunc(ctx, ids)
+}
+
+// GetOrdersRawCalls gets all the calls that were made to GetOrdersRaw.
+// Check the length with:
+//
+//	len(mockedRepository.GetOrdersRawCalls())
+func (mock *RepositoryMock) GetOrdersRawCalls() []struct {
+	Ctx context.Context
+	IDs []string
+} {
+	var calls []struct {
+		Ctx context.Context
+		IDs []string
+	}
+	mock.lockGetOrdersRaw.RLock()
+	calls = mock.calls.GetOrdersRaw
+	mock.lockGetOrdersRaw.RUnlock()
+	return calls
+}
+
+// ListOrders calls ListOrdersFunc.
+func (mock *RepositoryMock) ListOrders(ctx context.Context, f repo.OrderFilter, after *repo.OrderCursor, limit int) (repo.OrderPage, error) {
+	if mock.ListOrdersFunc == nil {
+		panic("RepositoryMock.ListOrdersFunc: method is nil but Repository.ListOrders was just called")
+	}
+	callInfo := struct {
+		Ctx   context.Context
+		F     repo.OrderFilter
+		After *repo.OrderCursor
+		Limit int
+	}{
+		Ctx:   ctx,
+		F:     f,
+		After: after,
+		Limit: limit,
+	}
+	mock.lockListOrders.Lock()
+	mock.calls.ListOrders = append(mock.calls.ListOrders, callInfo)
+	mock.lockListOrders.Unlock()
+	return mock.ListOrdersFunc(ctx, f, after, limit)
+}
+
+// ListOrdersCalls gets all the calls that were made to ListOrders.
+// Check the length with:
+//
+//	len(mockedRepository.ListOrdersCalls())
+func (mock *RepositoryMock) ListOrdersCalls() []struct {
+	Ctx   context.Context
+	F     repo.OrderFilter
+	After *repo.OrderCursor
+	Limit int
+} {
+	var calls []struct {
+		Ctx   context.Context
+		F     repo.OrderFilter
+		After *repo.OrderCursor
+		Limit int
+	}
+	mock.lockListOrders.RLock()
+	calls = mock.calls.ListOrders
+	mock.lockListOrders.RUnlock()
+	return calls
+}
+
+// LookupOrderUID calls LookupOrderUIDFunc.
+func (mock *RepositoryMock) LookupOrderUID(ctx context.Context, key repo.LookupKey, value string) (string, error) {
+	if mock.LookupOrderUIDFunc == nil {
+		panic("RepositoryMock.LookupOrderUIDFunc: method is nil but Repository.LookupOrderUID was just called")
+	}
+	callInfo := struct {
+		Ctx   context.Context
+		Key   repo.LookupKey
+		Value string
+	}{
+		Ctx:   ctx,
+		Key:   key,
+		Value: value,
+	}
+	mock.lockLookupOrderUID.Lock()
+	mock.calls.LookupOrderUID = append(mock.calls.LookupOrderUID, callInfo)
+	mock.lockLookupOrderUID.Unlock()
+	return mock.LookupOrderUIDFunc(ctx, key, value)
+}
+
+// LookupOrderUIDCalls gets all the calls that were made to LookupOrderUID.
+// Check the length with:
+//
+//	len(mockedRepository.LookupOrderUIDCalls())
+func (mock *RepositoryMock) LookupOrderUIDCalls() []struct {
+	Ctx   context.Context
+	Key   repo.LookupKey
+	Value string
+} {
+	var calls []struct {
+		Ctx   context.Context
+		Key   repo.LookupKey
+		Value string
+	}
+	mock.lockLookupOrderUID.RLock()
+	calls = mock.calls.LookupOrderUID
+	mock.lockLookupOrderUID.RUnlock()
+	return calls
+}
+
+// PruneLedger calls PruneLedgerFunc.
+func (mock *RepositoryMock) PruneLedger(ctx context.Context, olderThan time.Time) (int64, error) {
+	if mock.PruneLedgerFunc == nil {
+		panic("RepositoryMock.PruneLedgerFunc: method is nil but Repository.PruneLedger was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		OlderThan time.Time
+	}{
+		Ctx:       ctx,
+		OlderThan: olderThan,
+	}
+	mock.lockPruneLedger.Lock()
+	mock.calls.PruneLedger = append(mock.calls.PruneLedger, callInfo)
+	mock.lockPruneLedger.Unlock()
+	return mock.PruneLedgerFunc(ctx, olderThan)
+}
+
+// PruneLedgerCalls gets all the calls that were made to PruneLedger.
+// Check the length with:
+//
+//	len(mockedRepository.PruneLedgerCalls())
+func (mock *RepositoryMock) PruneLedgerCalls() []struct {
+	Ctx       context.Context
+	OlderThan time.Time
+} {
+	var calls []struct {
+		Ctx       context.Context
+		OlderThan time.Time
+	}
+	mock.lockPruneLedger.RLock()
+	calls = mock.calls.PruneLedger
+	mock.lockPruneLedger.RUnlock()
+	return calls
+}
+
 // UpsertOrder calls UpsertOrderFunc.
-func (mock *RepositoryMock) UpsertOrder(ctx context.Context, o *domain.Order, rawJSON []byte) error {
+func (mock *RepositoryMock) UpsertOrder(ctx context.Context, rec repo.OrderWithRaw) (repo.UpsertStatus, error) {
 	if mock.UpsertOrderFunc == nil {
 		panic("RepositoryMock.UpsertOrderFunc: method is nil but Repository.UpsertOrder was just called")
 	}
 	callInfo := struct {
-		Ctx     context.Context
-		O       *domain.Order
-		RawJSON []byte
+		Ctx context.Context
+		Rec repo.OrderWithRaw
 	}{
-		Ctx:     ctx,
-		O:       o,
-		RawJSON: rawJSON,
+		Ctx: ctx,
+		Rec: rec,
 	}
 	mock.lockUpsertOrder.Lock()
 	mock.calls.UpsertOrder = append(mock.calls.UpsertOrder, callInfo)
 	mock.lockUpsertOrder.Unlock()
-	return mock.UpsertOrderFunc(ctx, o, rawJSON)
+	return mock.UpsertOrderFunc(ctx, rec)
 }
 
 // UpsertOrderCalls gets all the calls that were made to UpsertOrder.
@@ -137,14 +465,12 @@ func (mock *RepositoryMock) UpsertOrder(ctx context.Context, o *domain.Order, ra
 //
 //	len(mockedRepository.UpsertOrderCalls())
 func (mock *RepositoryMock) UpsertOrderCalls() []struct {
-	Ctx     context.Context
-	O       *domain.Order
-	RawJSON []byte
+	Ctx context.Context
+	Rec repo.OrderWithRaw
 } {
 	var calls []struct {
-		Ctx     context.Context
-		O       *domain.Order
-		RawJSON []byte
+		Ctx context.Context
+		Rec repo.OrderWithRaw
 	}
 	mock.lockUpsertOrder.RLock()
 	calls = mock.calls.UpsertOrder
@@ -152,8 +478,44 @@ func (mock *RepositoryMock) UpsertOrderCalls() []struct {
 	return calls
 }
 
+// UpsertOrders calls UpsertOrdersFunc.
+func (mock *RepositoryMock) UpsertOrders(ctx context.Context, orders []repo.OrderWithRaw) ([]repo.UpsertStatus, error) {
+	if mock.UpsertOrdersFunc == nil {
+		panic("RepositoryMock.UpsertOrdersFunc: method is nil but Repository.UpsertOrders was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Orders []repo.OrderWithRaw
+	}{
+		Ctx:    ctx,
+		Orders: orders,
+	}
+	mock.lockUpsertOrders.Lock()
+	mock.calls.UpsertOrders = append(mock.calls.UpsertOrders, callInfo)
+	mock.lockUpsertOrders.Unlock()
+	return mock.UpsertOrdersFunc(ctx, orders)
+}
+
+// UpsertOrdersCalls gets all the calls that were made to UpsertOrders.
+// Check the length with:
+//
+//	len(mockedRepository.UpsertOrdersCalls())
+func (mock *RepositoryMock) UpsertOrdersCalls() []struct {
+	Ctx    context.Context
+	Orders []repo.OrderWithRaw
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Orders []repo.OrderWithRaw
+	}
+	mock.lockUpsertOrders.RLock()
+	calls = mock.calls.UpsertOrders
+	mock.lockUpsertOrders.RUnlock()
+	return calls
+}
+
 // Warmup calls WarmupFunc.
-func (mock *RepositoryMock) Warmup(ctx context.Context, limit int) (map[string][]byte, error) {
+func (mock *RepositoryMock) Warmup(ctx context.Context, limit int) (map[string]repo.StoredOrder, error) {
 	if mock.WarmupFunc == nil {
 		panic("RepositoryMock.WarmupFunc: method is nil but Repository.Warmup was just called")
 	}
@@ -0,0 +1,160 @@
+// Package outbox publishes the events stored by repo in the outbox table to
+// Kafka.
+package outbox
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+// Headers set on every published event.
+const (
+	HeaderEventType = "x-event-type"
+	HeaderOutboxID  = "x-outbox-id"
+)
+
+//go:generate moq -pkg mocks -skip-ensure -out ../mocks/outbox_store_mock.go . Store:OutboxStoreMock
+
+// Store is the outbox side of the repository.
+type Store interface {
+	RelayOutbox(ctx context.Context, limit int, publish func(context.Context, []repo.OutboxEvent) error) (int, error)
+	PruneOutbox(ctx context.Context, sentBefore time.Time) (int64, error)
+}
+
+// Writer publishes messages; *kafka.Writer implements it.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Config tunes the relay.
+type Config struct {
+	// BatchSize is the maximum number of events published at once.
+	BatchSize int
+	// PollInterval is the pause after the outbox was found drained.
+	PollInterval time.Duration
+	// InitialBackoff is the pause after a failed publish; it doubles with
+	// every consecutive failure up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Retention is how long sent events are kept; zero keeps them forever.
+	Retention time.Duration
+	// PruneInterval is how often sent events are pruned.
+	PruneInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:      100,
+		PollInterval:   500 * time.Millisecond,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Retention:      72 * time.Hour,
+		PruneInterval:  time.Hour,
+	}
+}
+
+// Relay moves outbox events to Kafka with at-least-once delivery: an event is
+// marked sent only after the broker acknowledged it, and events are keyed by
+// order_uid, so the events of one order keep their order in one partition.
+type Relay struct {
+	store Store
+	w     Writer
+	cfg   Config
+}
+
+func NewRelay(store Store, w Writer, cfg Config) *Relay {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	return &Relay{store: store, w: w, cfg: cfg}
+}
+
+// Run relays events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	if r.cfg.Retention > 0 && r.cfg.PruneInterval > 0 {
+		go r.prune(ctx)
+	}
+
+	failures := 0
+	for {
+		n, err := r.store.RelayOutbox(ctx, r.cfg.BatchSize, r.publish)
+		var wait time.Duration
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			failures++
+			wait = r.backoff(failures)
+			log.Printf("outbox relay: publish failed (attempt %d), retrying in %s: %v", failures, wait, err)
+		case n < r.cfg.BatchSize:
+			failures = 0
+			wait = r.cfg.PollInterval
+		default:
+			// A full batch: more events are likely pending.
+			failures = 0
+		}
+		if wait <= 0 {
+			continue
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, events []repo.OutboxEvent) error {
+	msgs := make([]kafka.Message, len(events))
+	for i, e := range events {
+		msgs[i] = kafka.Message{
+			Key:   []byte(e.OrderUID),
+			Value: e.Payload,
+			Time:  e.CreatedAt,
+			Headers: []kafka.Header{
+				{Key: HeaderEventType, Value: []byte(e.Type)},
+				{Key: HeaderOutboxID, Value: []byte(strconv.FormatInt(e.ID, 10))},
+			},
+		}
+	}
+	return r.w.WriteMessages(ctx, msgs...)
+}
+
+func (r *Relay) backoff(failures int) time.Duration {
+	d := r.cfg.InitialBackoff
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if r.cfg.MaxBackoff > 0 && d >= r.cfg.MaxBackoff {
+			return r.cfg.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (r *Relay) prune(ctx context.Context) {
+	t := time.NewTicker(r.cfg.PruneInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := r.store.PruneOutbox(ctx, time.Now().Add(-r.cfg.Retention))
+			if err != nil {
+				log.Printf("outbox prune warn: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("outbox prune: removed %d events", n)
+			}
+		}
+	}
+}
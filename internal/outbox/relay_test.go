@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func TestRelay_RetriesFailedBatchInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pending := []repo.OutboxEvent{
+		{ID: 1, OrderUID: "A", Type: repo.EventOrderPersisted, Payload: []byte(`{"n":1}`)},
+		{ID: 2, OrderUID: "B", Type: repo.EventOrderPersisted, Payload: []byte(`{"n":2}`)},
+		{ID: 3, OrderUID: "A", Type: repo.EventOrderDeleted, Payload: []byte(`{"n":3}`)},
+	}
+	store := &mocks.OutboxStoreMock{}
+	store.RelayOutboxFunc = func(ctx context.Context, limit int, publish func(context.Context, []repo.OutboxEvent) error) (int, error) {
+		if len(pending) == 0 {
+			cancel()
+			return 0, nil
+		}
+		batch := pending[:min(limit, len(pending))]
+		if err := publish(ctx, batch); err != nil {
+			return 0, err
+		}
+		pending = pending[len(batch):]
+		return len(batch), nil
+	}
+
+	var published [][]kafka.Message
+	w := &mocks.MessageWriterMock{}
+	w.WriteMessagesFunc = func(_ context.Context, msgs ...kafka.Message) error {
+		published = append(published, msgs)
+		if len(published) == 1 {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}
+
+	cfg := Config{BatchSize: 2, PollInterval: time.Millisecond, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	if err := NewRelay(store, w, cfg).Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	var ids []string
+	for _, batch := range published {
+		for _, m := range batch {
+			ids = append(ids, string(m.Headers[1].Value))
+		}
+	}
+	if got, want := ids, []string{"1", "2", "1", "2", "3"}; !slices.Equal(got, want) {
+		t.Fatalf("published outbox ids %v, want %v", got, want)
+	}
+	last := published[len(published)-1][0]
+	if string(last.Key) != "A" || string(last.Value) != `{"n":3}` || string(last.Headers[0].Value) != repo.EventOrderDeleted {
+		t.Fatalf("unexpected message %+v", last)
+	}
+}
+
+func TestRelay_Backoff(t *testing.T) {
+	r := NewRelay(nil, nil, Config{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for failures, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := r.backoff(failures); got != want {
+			t.Fatalf("backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package pii masks the personal data of orders by the role of whoever
+// receives it.
+package pii
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Role decides how much personal data its holder sees.
+type Role string
+
+const (
+	// RolePrivileged sees personal data as is.
+	RolePrivileged Role = "privileged"
+	// RoleSupport sees enough to recognize a customer, e.g. +97*****000
+	// or t***@gmail.com.
+	RoleSupport Role = "support"
+	// RoleAnalytics sees no personal data at all.
+	RoleAnalytics Role = "analytics"
+)
+
+// Hidden replaces a value hidden from a role entirely.
+const Hidden = "***"
+
+// Roles lists the known roles, most privileged first.
+func Roles() []Role {
+	return []Role{RolePrivileged, RoleSupport, RoleAnalytics}
+}
+
+// ParseRole returns the role named s.
+func ParseRole(s string) (Role, error) {
+	for _, r := range Roles() {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role %q", s)
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the role of the caller.
+func NewContext(ctx context.Context, r Role) context.Context {
+	return context.WithValue(ctx, ctxKey{}, r)
+}
+
+// FromContext returns the role of the caller stored by NewContext.
+func FromContext(ctx context.Context) (Role, bool) {
+	r, ok := ctx.Value(ctxKey{}).(Role)
+	return r, ok
+}
+
+// Phone keeps the first and last three characters of a phone number for
+// support: +9720000000 becomes +97*****000.
+func Phone(v string, r Role) string {
+	return mask(v, r, func(v string) string {
+		n := utf8.RuneCountInString(v)
+		if n < 8 {
+			return Hidden
+		}
+		runes := []rune(v)
+		return string(runes[:3]) + strings.Repeat("*", n-6) + string(runes[n-3:])
+	})
+}
+
+// Email keeps the first character of the local part and the domain for
+// support: test@gmail.com becomes t***@gmail.com.
+func Email(v string, r Role) string {
+	return mask(v, r, func(v string) string {
+		local, domain, ok := strings.Cut(v, "@")
+		if !ok || local == "" {
+			return Hidden
+		}
+		first, _ := utf8.DecodeRuneInString(local)
+		return string(first) + "***@" + domain
+	})
+}
+
+// Name keeps the first word and the initials of the others for support:
+// Test Testov becomes Test T.
+func Name(v string, r Role) string {
+	return mask(v, r, func(v string) string {
+		words := strings.Fields(v)
+		for i := 1; i < len(words); i++ {
+			first, _ := utf8.DecodeRuneInString(words[i])
+			words[i] = string(first) + "."
+		}
+		return strings.Join(words, " ")
+	})
+}
+
+// Address hides the digits of an address, i.e. house and flat numbers, from
+// support: Ploshad Mira 15 becomes Ploshad Mira **.
+func Address(v string, r Role) string {
+	return mask(v, r, func(v string) string {
+		return strings.Map(func(c rune) rune {
+			if unicode.IsDigit(c) {
+				return '*'
+			}
+			return c
+		}, v)
+	})
+}
+
+// Transaction keeps the last four characters of a payment transaction for
+// support.
+func Transaction(v string, r Role) string {
+	return mask(v, r, func(v string) string {
+		runes := []rune(v)
+		if len(runes) <= 4 {
+			return Hidden
+		}
+		return Hidden + string(runes[len(runes)-4:])
+	})
+}
+
+// mask returns v as role r sees it, using partial for support. Unknown
+// roles see nothing, as analytics.
+func mask(v string, r Role, partial func(string) string) string {
+	switch {
+	case v == "" || r == RolePrivileged:
+		return v
+	case r == RoleSupport:
+		return partial(v)
+	}
+	return Hidden
+}
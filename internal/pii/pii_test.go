@@ -0,0 +1,81 @@
+package pii_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+)
+
+func TestMaskByRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		mask       func(string, pii.Role) string
+		in         string
+		support    string
+		privileged string
+	}{
+		{"phone", pii.Phone, "+9720000000", "+97*****000", "+9720000000"},
+		{"short phone", pii.Phone, "+12345", pii.Hidden, "+12345"},
+		{"email", pii.Email, "test@gmail.com", "t***@gmail.com", "test@gmail.com"},
+		{"not an email", pii.Email, "test", pii.Hidden, "test"},
+		{"name", pii.Name, "Test Testov", "Test T.", "Test Testov"},
+		{"address", pii.Address, "Ploshad Mira 15", "Ploshad Mira **", "Ploshad Mira 15"},
+		{"transaction", pii.Transaction, "b563feb7b2b84b6test", "***test", "b563feb7b2b84b6test"},
+		{"empty", pii.Phone, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mask(tt.in, pii.RolePrivileged); got != tt.privileged {
+				t.Errorf("privileged: got %q, want %q", got, tt.privileged)
+			}
+			if got := tt.mask(tt.in, pii.RoleSupport); got != tt.support {
+				t.Errorf("support: got %q, want %q", got, tt.support)
+			}
+			want := pii.Hidden
+			if tt.in == "" {
+				want = ""
+			}
+			for _, r := range []pii.Role{pii.RoleAnalytics, "unknown"} {
+				if got := tt.mask(tt.in, r); got != want {
+					t.Errorf("%s: got %q, want %q", r, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, r := range pii.Roles() {
+		if got, err := pii.ParseRole(string(r)); err != nil || got != r {
+			t.Fatalf("%s: got %q, %v", r, got, err)
+		}
+	}
+	if _, err := pii.ParseRole("admin"); err == nil {
+		t.Fatal("expected an error for an unknown role")
+	}
+}
+
+func TestOrderIsMaskedInLogs(t *testing.T) {
+	o := domain.Order{
+		OrderUID: "b563feb7b2b84b6test",
+		Delivery: domain.Delivery{Name: "Test Testov", Phone: "+9720000000", City: "Kiryat Mozkin", Address: "Ploshad Mira 15", Email: "test@gmail.com"},
+		Payment:  domain.Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD"},
+	}
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		got := fmt.Sprintf(format, &o)
+		for _, secret := range []string{"Testov", "+9720000000", "Mira 15", "test@gmail.com"} {
+			if strings.Contains(got, secret) {
+				t.Errorf("%s leaks %q: %s", format, secret, got)
+			}
+		}
+		if !strings.Contains(got, "Kiryat Mozkin") || !strings.Contains(got, "USD") {
+			t.Errorf("%s lost other fields: %s", format, got)
+		}
+	}
+	if o.Delivery.Phone != "+9720000000" {
+		t.Fatal("formatting changed the order")
+	}
+}
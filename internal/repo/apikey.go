@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrAPIKeyNotFound is returned for an unknown or revoked API key.
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a static HTTP API credential; only the hash of the key is stored.
+type APIKey struct {
+	Name   string
+	Scopes []string
+}
+
+// LookupAPIKey returns the active API key with hash or ErrAPIKeyNotFound.
+func (p *Postgres) LookupAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	var k APIKey
+	err := p.pool.QueryRow(ctx, `SELECT name, scopes FROM api_keys WHERE key_hash=$1 AND active`, hash).Scan(&k.Name, &k.Scopes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("api key lookup: %w", err)
+	}
+	return k, nil
+}
@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Outbox event types, published to downstream consumers.
+const (
+	EventOrderPersisted = "order.persisted"
+	EventOrderDeleted   = "order.deleted"
+)
+
+// outboxLockKey is the advisory lock that lets a single relay publish at a
+// time, which keeps events of one order in commit order.
+const outboxLockKey int64 = 0x6f7574626f78 // "outbox"
+
+// OutboxEvent is an outbox row waiting to be published.
+type OutboxEvent struct {
+	ID        int64
+	OrderUID  string
+	Type      string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// outboxPayload is the body of a published event.
+type outboxPayload struct {
+	Type          string        `json:"type"`
+	OrderUID      string        `json:"order_uid"`
+	Version       int64         `json:"version,omitempty"`
+	SchemaVersion int           `json:"schema_version,omitempty"`
+	Source        *outboxSource `json:"source,omitempty"`
+	OccurredAt    time.Time     `json:"occurred_at"`
+}
+
+type outboxSource struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// Option configures Postgres.
+type Option func(*Postgres)
+
+// WithOutbox makes every applied write also insert an outbox row in the same
+// transaction, to be published by a relay.
+func WithOutbox() Option {
+	return func(p *Postgres) { p.outbox = true }
+}
+
+func persisted(o *domain.Order, version int64) outboxPayload {
+	return outboxPayload{Type: EventOrderPersisted, OrderUID: o.OrderUID, Version: version, SchemaVersion: domain.SchemaVersion}
+}
+
+// queueOutboxRow queues ev when the outbox is enabled.
+func (p *Postgres) queueOutboxRow(b *pgx.Batch, steps []string, ev outboxPayload, src *MessageRef) []string {
+	if !p.outbox {
+		return steps
+	}
+	if src != nil {
+		ev.Source = &outboxSource{Topic: src.Topic, Partition: src.Partition, Offset: src.Offset}
+	}
+	ev.OccurredAt = time.Now().UTC()
+	payload, _ := json.Marshal(ev)
+	b.Queue(`INSERT INTO outbox (order_uid, event_type, payload) VALUES ($1,$2,$3)`,
+		ev.OrderUID, ev.Type, json.RawMessage(payload))
+	return append(steps, "outbox insert "+ev.OrderUID)
+}
+
+// RelayOutbox passes up to limit unsent events, oldest first, to publish and
+// marks them sent once it succeeds. A failed publish leaves them pending with
+// the attempt recorded, so the next call retries the same events in the same
+// order. Calls from several instances are serialized by an advisory lock; the
+// ones that do not get it return zero without publishing.
+func (p *Postgres) RelayOutbox(ctx context.Context, limit int, publish func(context.Context, []OutboxEvent) error) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockKey).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("outbox lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+SELECT id, order_uid, event_type, payload, created_at FROM outbox
+WHERE sent_at IS NULL
+ORDER BY id
+LIMIT $1`, limit)
+	if err != nil {
+		return 0, err
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxEvent, error) {
+		var e OutboxEvent
+		err := row.Scan(&e.ID, &e.OrderUID, &e.Type, &e.Payload, &e.CreatedAt)
+		return e, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("outbox read: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, tx.Commit(ctx)
+	}
+
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	if perr := publish(ctx, events); perr != nil {
+		_, err := tx.Exec(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = ANY($1)`, ids, perr.Error())
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		return 0, errors.Join(perr, err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE outbox SET sent_at = now(), attempts = attempts + 1, last_error = NULL WHERE id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("outbox mark sent: %w", err)
+	}
+	return len(events), tx.Commit(ctx)
+}
+
+// PruneOutbox removes events sent before sentBefore and returns how many were deleted.
+func (p *Postgres) PruneOutbox(ctx context.Context, sentBefore time.Time) (int64, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM outbox WHERE sent_at < $1`, sentBefore)
+	if err != nil {
+		return 0, fmt.Errorf("outbox prune: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
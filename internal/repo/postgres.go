@@ -5,42 +5,406 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/kosovrzn/wb-tech-l0/internal/codec"
 	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+	"github.com/kosovrzn/wb-tech-l0/internal/upcast"
+	"github.com/kosovrzn/wb-tech-l0/internal/validation"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 //go:generate moq -pkg mocks -out ../mocks/repository_mock.go . Repository
 
 type Repository interface {
-	UpsertOrder(ctx context.Context, o *domain.Order, rawJSON []byte) error
-	GetOrderRaw(ctx context.Context, id string) ([]byte, error)
-	Warmup(ctx context.Context, limit int) (map[string][]byte, error)
+	UpsertOrder(ctx context.Context, rec OrderWithRaw) (UpsertStatus, error)
+	UpsertOrders(ctx context.Context, orders []OrderWithRaw) ([]UpsertStatus, error)
+	GetOrderRaw(ctx context.Context, id string) (StoredOrder, error)
+	GetOrdersRaw(ctx context.Context, ids []string) (map[string]StoredOrder, error)
+	Warmup(ctx context.Context, limit int) (map[string]StoredOrder, error)
+	PruneLedger(ctx context.Context, olderThan time.Time) (int64, error)
+	ApplyPatch(ctx context.Context, rec OrderPatch) (UpsertStatus, []byte, error)
+	DeleteOrder(ctx context.Context, rec OrderDeletion) (UpsertStatus, error)
+	ListOrders(ctx context.Context, f OrderFilter, after *OrderCursor, limit int) (OrderPage, error)
+	LookupOrderUID(ctx context.Context, key LookupKey, value string) (string, error)
+}
+
+// ErrNotFound is returned when the requested order is not stored.
+var ErrNotFound = errors.New("order not found")
+
+// ErrInvalidOrder is returned when a patch would leave the stored order
+// invalid; the order is left as it was.
+var ErrInvalidOrder = errors.New("patched order is invalid")
+
+// StoredOrder is the stored payload of an order and when it was last written.
+type StoredOrder struct {
+	Raw       []byte
+	UpdatedAt time.Time
+}
+
+// OrderWithRaw pairs a decoded order with the payload it was decoded from.
+type OrderWithRaw struct {
+	Order *domain.Order
+	Raw   []byte
+	// Version orders writes of the same order: a stored row is only
+	// overwritten by a strictly greater version.
+	Version int64
+	// Source identifies the Kafka message the order came from. When set, it is
+	// recorded in the processed_messages ledger and replays are skipped.
+	Source *MessageRef
+	// Force overwrites the stored order regardless of version and ledger,
+	// which is what a replay after a bug fix needs.
+	Force bool
+	// UpdatedAt is stored as the order's updated_at; zero means now. Callers
+	// caching the order pass the time they cache it with.
+	UpdatedAt time.Time
+}
+
+// OrderPatch is a partial update of a stored order with the same version,
+// ledger and force semantics as OrderWithRaw.
+type OrderPatch struct {
+	Patch     domain.Patch
+	Version   int64
+	Source    *MessageRef
+	Force     bool
+	UpdatedAt time.Time
+}
+
+// OrderDeletion asks to erase an order, e.g. because of a Kafka tombstone.
+type OrderDeletion struct {
+	OrderUID string
+	Source   *MessageRef
+	Force    bool
+}
+
+// MessageRef is the position of a message in Kafka.
+type MessageRef struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// UpsertStatus is the outcome of storing a single order.
+type UpsertStatus int
+
+const (
+	// Applied means the order was written.
+	Applied UpsertStatus = iota
+	// Stale means a newer version of the order was already stored.
+	Stale
+	// Duplicate means the source message was already processed.
+	Duplicate
+)
+
+func (s UpsertStatus) String() string {
+	switch s {
+	case Applied:
+		return "applied"
+	case Stale:
+		return "stale"
+	case Duplicate:
+		return "duplicate"
+	default:
+		return fmt.Sprintf("UpsertStatus(%d)", int(s))
+	}
 }
 
 type Postgres struct {
-	pool *pgxpool.Pool
+	pool      *pgxpool.Pool
+	validator *validation.Validator
+	outbox    bool
+	webhooks  bool
+}
+
+func NewPostgres(pool *pgxpool.Pool, opts ...Option) *Postgres {
+	p := &Postgres{pool: pool, validator: validation.New()}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// UpsertOrder stores rec and reports whether it was applied or skipped.
+func (p *Postgres) UpsertOrder(ctx context.Context, rec OrderWithRaw) (UpsertStatus, error) {
+	statuses, err := p.UpsertOrders(ctx, []OrderWithRaw{rec})
+	if err != nil {
+		return 0, err
+	}
+	return statuses[0], nil
+}
+
+// UpsertOrders writes all orders in a single transaction. It takes one batch
+// round-trip each for the ledger rows, the orders rows and the dependent rows
+// of the orders that applied. Either every order is stored or none is.
+// The returned slice holds the outcome of each input order.
+func (p *Postgres) UpsertOrders(ctx context.Context, orders []OrderWithRaw) ([]UpsertStatus, error) {
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	for _, rec := range orders {
+		if rec.Order == nil || rec.Order.OrderUID == "" {
+			return nil, errors.New("empty order_uid")
+		}
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	statuses := make([]UpsertStatus, len(orders))
+
+	b := &pgx.Batch{}
+	var steps []string
+	var logged []int
+	for i, rec := range orders {
+		if rec.Source != nil {
+			steps = queueLedgerRow(b, steps, rec.Order.OrderUID, rec.Source)
+			logged = append(logged, i)
+		}
+	}
+	tags, err := execBatch(ctx, tx, b, steps)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range logged {
+		if tags[j].RowsAffected() == 0 && !orders[i].Force {
+			statuses[i] = Duplicate
+		}
+	}
+
+	b = &pgx.Batch{}
+	steps = steps[:0]
+	var written []int
+	for i, rec := range orders {
+		if statuses[i] != Duplicate {
+			steps = queueOrderRow(b, steps, rec)
+			written = append(written, i)
+		}
+	}
+	if tags, err = execBatch(ctx, tx, b, steps); err != nil {
+		return nil, err
+	}
+
+	b = &pgx.Batch{}
+	steps = steps[:0]
+	for j, i := range written {
+		if tags[j].RowsAffected() == 0 {
+			statuses[i] = Stale
+			continue
+		}
+		steps = queueOrderDetails(b, steps, orders[i].Order)
+		steps = p.queueOutboxRow(b, steps, persisted(orders[i].Order, orders[i].Version), orders[i].Source)
+		steps = p.queueWebhookDeliveries(b, steps, EventOrderPersisted, orders[i].Order.OrderUID, orders[i].Raw)
+	}
+	if _, err := execBatch(ctx, tx, b, steps); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return statuses, nil
 }
 
-func NewPostgres(pool *pgxpool.Pool) *Postgres { return &Postgres{pool: pool} }
+// ApplyPatch applies rec to the stored order in one transaction: the patch is
+// merged into raw_payload and the normalized tables are rewritten from the
+// result, which is returned for the cache. ErrNotFound means the order does
+// not exist yet.
+func (p *Postgres) ApplyPatch(ctx context.Context, rec OrderPatch) (UpsertStatus, []byte, error) {
+	if rec.Patch == nil || rec.Patch.OrderID() == "" {
+		return 0, nil, errors.New("empty order_uid")
+	}
+	id := rec.Patch.OrderID()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if rec.Source != nil {
+		b := &pgx.Batch{}
+		steps := queueLedgerRow(b, nil, id, rec.Source)
+		tags, err := execBatch(ctx, tx, b, steps)
+		if err != nil {
+			return 0, nil, err
+		}
+		if tags[0].RowsAffected() == 0 && !rec.Force {
+			return Duplicate, nil, tx.Commit(ctx)
+		}
+	}
+
+	var raw []byte
+	var version int64
+	var schema int
+	err = tx.QueryRow(ctx, `SELECT raw_payload, version, schema_version FROM orders WHERE order_uid=$1 FOR UPDATE`, id).Scan(&raw, &version, &schema)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, fmt.Errorf("patch order %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if !rec.Force && version >= rec.Version {
+		return Stale, nil, tx.Commit(ctx)
+	}
+	o, raw, err := p.patched(id, raw, schema, rec.Patch)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	b := &pgx.Batch{}
+	steps := queueOrderRow(b, nil, OrderWithRaw{Order: o, Raw: raw, Version: rec.Version, Force: true, UpdatedAt: rec.UpdatedAt})
+	steps = queueOrderDetails(b, steps, o)
+	steps = p.queueOutboxRow(b, steps, persisted(o, rec.Version), rec.Source)
+	steps = p.queueWebhookDeliveries(b, steps, EventOrderPersisted, o.OrderUID, raw)
+	if _, err := execBatch(ctx, tx, b, steps); err != nil {
+		return 0, nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, nil, err
+	}
+	return Applied, raw, nil
+}
+
+// patched applies patch to raw, the stored payload of order id at schema
+// version schema, and returns the result with its canonical payload. The
+// result is validated like a snapshot, since a patch may blank required fields.
+func (p *Postgres) patched(id string, raw []byte, schema int, patch domain.Patch) (*domain.Order, []byte, error) {
+	raw, err := upcast.Order(raw, schema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stored order %s: %w", id, err)
+	}
+	var o domain.Order
+	if err := json.Unmarshal(raw, &o); err != nil {
+		return nil, nil, fmt.Errorf("decode stored order %s: %w", id, err)
+	}
+	if err := patch.Apply(&o); err != nil {
+		return nil, nil, err
+	}
+	if err := p.validator.ValidateOrder(&o); err != nil {
+		return nil, nil, fmt.Errorf("order %s: %w: %w", id, ErrInvalidOrder, err)
+	}
+	if raw, err = codec.Canonical(&o); err != nil {
+		return nil, nil, err
+	}
+	return &o, raw, nil
+}
 
-func (p *Postgres) UpsertOrder(ctx context.Context, o *domain.Order, rawJSON []byte) error {
-	if o.OrderUID == "" {
-		return errors.New("empty order_uid")
+// DeleteOrder removes the order together with its deliveries, payments and
+// items rows and records the erasure in order_deletions. Deleting an order
+// that is not stored still leaves an audit row.
+func (p *Postgres) DeleteOrder(ctx context.Context, rec OrderDeletion) (UpsertStatus, error) {
+	if rec.OrderUID == "" {
+		return 0, errors.New("empty order_uid")
 	}
+
 	tx, err := p.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	_, err = tx.Exec(ctx, `
+	if rec.Source != nil {
+		b := &pgx.Batch{}
+		steps := queueLedgerRow(b, nil, rec.OrderUID, rec.Source)
+		tags, err := execBatch(ctx, tx, b, steps)
+		if err != nil {
+			return 0, err
+		}
+		if tags[0].RowsAffected() == 0 && !rec.Force {
+			return Duplicate, tx.Commit(ctx)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM orders WHERE order_uid=$1`, rec.OrderUID)
+	if err != nil {
+		return 0, fmt.Errorf("orders delete %s: %w", rec.OrderUID, err)
+	}
+
+	var topic *string
+	var partition *int
+	var offset *int64
+	if rec.Source != nil {
+		topic, partition, offset = &rec.Source.Topic, &rec.Source.Partition, &rec.Source.Offset
+	}
+	if _, err := tx.Exec(ctx, `
+INSERT INTO order_deletions (order_uid, existed, topic, partition, "offset")
+VALUES ($1,$2,$3,$4,$5)`, rec.OrderUID, tag.RowsAffected() > 0, topic, partition, offset); err != nil {
+		return 0, fmt.Errorf("deletion audit %s: %w", rec.OrderUID, err)
+	}
+	b := &pgx.Batch{}
+	steps := p.queueOutboxRow(b, nil, outboxPayload{Type: EventOrderDeleted, OrderUID: rec.OrderUID}, rec.Source)
+	steps = p.queueWebhookDeliveries(b, steps, EventOrderDeleted, rec.OrderUID, nil)
+	if _, err := execBatch(ctx, tx, b, steps); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return Applied, nil
+}
+
+// queueLedgerRow records the source message of rec. RowsAffected is zero when
+// the message was already processed.
+func queueLedgerRow(b *pgx.Batch, steps []string, id string, src *MessageRef) []string {
+	b.Queue(`
+INSERT INTO processed_messages (topic, partition, "offset", order_uid)
+VALUES ($1,$2,$3,$4)
+ON CONFLICT DO NOTHING`, src.Topic, src.Partition, src.Offset, id)
+	return append(steps, "ledger insert "+id)
+}
+
+// PruneLedger removes ledger rows recorded before olderThan and returns how many were deleted.
+func (p *Postgres) PruneLedger(ctx context.Context, olderThan time.Time) (int64, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM processed_messages WHERE processed_at < $1`, olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("ledger prune: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// execBatch sends b and reads one result per queued statement, labelling a
+// failure with the matching entry of steps.
+func execBatch(ctx context.Context, tx pgx.Tx, b *pgx.Batch, steps []string) ([]pgconn.CommandTag, error) {
+	if b.Len() == 0 {
+		return nil, nil
+	}
+	br := tx.SendBatch(ctx, b)
+	tags := make([]pgconn.CommandTag, 0, len(steps))
+	for _, step := range steps {
+		tag, err := br.Exec()
+		if err != nil {
+			_ = br.Close()
+			return nil, fmt.Errorf("%s: %w", step, err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, br.Close()
+}
+
+// queueOrderRow queues the orders upsert for rec. An existing row is only
+// touched when rec carries a newer version or is forced, so RowsAffected tells
+// whether it applied. rec.Raw is codec.Canonical output, so the row is of the
+// current schema version whatever rec.Order itself says.
+func queueOrderRow(b *pgx.Batch, steps []string, rec OrderWithRaw) []string {
+	o := rec.Order
+	updatedAt := rec.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	b.Queue(`
 INSERT INTO orders (
   order_uid, track_number, entry, locale, internal_signature, customer_id,
-  delivery_service, shardkey, sm_id, date_created, oof_shard, raw_payload, updated_at
+  delivery_service, shardkey, sm_id, date_created, oof_shard, raw_payload, version,
+  cancelled_at, cancel_reason, schema_version, updated_at
 ) VALUES (
-  $1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12, now()
+  $1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$15,$16,$17,$18
 )
 ON CONFLICT (order_uid) DO UPDATE SET
   track_number = EXCLUDED.track_number,
@@ -54,14 +418,21 @@ ON CONFLICT (order_uid) DO UPDATE SET
   date_created = EXCLUDED.date_created,
   oof_shard    = EXCLUDED.oof_shard,
   raw_payload  = EXCLUDED.raw_payload,
-  updated_at   = now();
+  version      = EXCLUDED.version,
+  cancelled_at = EXCLUDED.cancelled_at,
+  cancel_reason = EXCLUDED.cancel_reason,
+  schema_version = EXCLUDED.schema_version,
+  updated_at   = EXCLUDED.updated_at
+WHERE $14 OR orders.version < EXCLUDED.version;
 `, o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature, o.CustomerID,
-		o.DeliveryService, o.Shardkey, o.SmID, o.DateCreated, o.OofShard, json.RawMessage(rawJSON))
-	if err != nil {
-		return fmt.Errorf("orders upsert: %w", err)
-	}
+		o.DeliveryService, o.Shardkey, o.SmID, o.DateCreated, o.OofShard, json.RawMessage(rec.Raw), rec.Version, rec.Force,
+		o.CancelledAt, o.CancelReason, domain.SchemaVersion, updatedAt)
+	return append(steps, "orders upsert "+o.OrderUID)
+}
 
-	_, err = tx.Exec(ctx, `
+// queueOrderDetails queues the deliveries, payments and items rows of o.
+func queueOrderDetails(b *pgx.Batch, steps []string, o *domain.Order) []string {
+	b.Queue(`
 INSERT INTO deliveries (
   order_uid, name, phone, zip, city, address, region, email
 ) VALUES (
@@ -71,11 +442,9 @@ ON CONFLICT (order_uid) DO UPDATE SET
   name=$2, phone=$3, zip=$4, city=$5, address=$6, region=$7, email=$8;
 `, o.OrderUID, o.Delivery.Name, o.Delivery.Phone, o.Delivery.Zip, o.Delivery.City,
 		o.Delivery.Address, o.Delivery.Region, o.Delivery.Email)
-	if err != nil {
-		return fmt.Errorf("deliveries upsert: %w", err)
-	}
+	steps = append(steps, "deliveries upsert "+o.OrderUID)
 
-	_, err = tx.Exec(ctx, `
+	b.Queue(`
 INSERT INTO payments (
   order_uid, transaction, request_id, currency, provider, amount,
   payment_dt, bank, delivery_cost, goods_total, custom_fee
@@ -87,40 +456,69 @@ ON CONFLICT (order_uid) DO UPDATE SET
   payment_dt=$7, bank=$8, delivery_cost=$9, goods_total=$10, custom_fee=$11;
 `, o.OrderUID, o.Payment.Transaction, o.Payment.RequestID, o.Payment.Currency, o.Payment.Provider,
 		o.Payment.Amount, o.Payment.PaymentDT, o.Payment.Bank, o.Payment.DeliveryCost, o.Payment.GoodsTotal, o.Payment.CustomFee)
-	if err != nil {
-		return fmt.Errorf("payments upsert: %w", err)
-	}
+	steps = append(steps, "payments upsert "+o.OrderUID)
+
+	b.Queue(`DELETE FROM items WHERE order_uid = $1`, o.OrderUID)
+	steps = append(steps, "items delete "+o.OrderUID)
 
-	_, err = tx.Exec(ctx, `DELETE FROM items WHERE order_uid = $1`, o.OrderUID)
-	if err != nil {
-		return fmt.Errorf("items delete: %w", err)
-	}
 	for _, it := range o.Items {
-		_, err = tx.Exec(ctx, `
+		b.Queue(`
 INSERT INTO items (
   order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
 ) VALUES (
   $1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12
 )`, o.OrderUID, it.ChrtID, it.TrackNumber, it.Price, it.RID, it.Name, it.Sale, it.Size, it.TotalPrice, it.NmID, it.Brand, it.Status)
-		if err != nil {
-			return fmt.Errorf("items insert: %w", err)
-		}
+		steps = append(steps, "items insert "+o.OrderUID)
 	}
+	return steps
+}
 
-	if err := tx.Commit(ctx); err != nil {
-		return err
+// GetOrderRaw returns the stored payload of order id, upcast to the current
+// schema version when it was written by an older one, or ErrNotFound.
+func (p *Postgres) GetOrderRaw(ctx context.Context, id string) (StoredOrder, error) {
+	var o StoredOrder
+	var schema int
+	err := p.pool.QueryRow(ctx, `SELECT raw_payload, schema_version, updated_at FROM orders WHERE order_uid=$1`, id).
+		Scan(&o.Raw, &schema, &o.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return StoredOrder{}, fmt.Errorf("order %s: %w", id, ErrNotFound)
 	}
-	return nil
+	if err != nil {
+		return StoredOrder{}, err
+	}
+	if o.Raw, err = upcast.Order(o.Raw, schema); err != nil {
+		return StoredOrder{}, err
+	}
+	return o, nil
 }
 
-func (p *Postgres) GetOrderRaw(ctx context.Context, id string) ([]byte, error) {
-	var raw []byte
-	err := p.pool.QueryRow(ctx, `SELECT raw_payload FROM orders WHERE order_uid=$1`, id).Scan(&raw)
-	return raw, err
+// GetOrdersRaw returns the stored payloads of the orders among ids, upcast
+// like GetOrderRaw, in a single query. Missing orders are absent from the map.
+func (p *Postgres) GetOrdersRaw(ctx context.Context, ids []string) (map[string]StoredOrder, error) {
+	rows, err := p.pool.Query(ctx, `SELECT order_uid, raw_payload, schema_version, updated_at FROM orders WHERE order_uid = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]StoredOrder, len(ids))
+	for rows.Next() {
+		var id string
+		var o StoredOrder
+		var schema int
+		if err := rows.Scan(&id, &o.Raw, &schema, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if o.Raw, err = upcast.Order(o.Raw, schema); err != nil {
+			return nil, fmt.Errorf("stored order %s: %w", id, err)
+		}
+		out[id] = o
+	}
+	return out, rows.Err()
 }
 
-func (p *Postgres) Warmup(ctx context.Context, limit int) (map[string][]byte, error) {
-	q := `SELECT order_uid, raw_payload FROM orders ORDER BY updated_at DESC`
+func (p *Postgres) Warmup(ctx context.Context, limit int) (map[string]StoredOrder, error) {
+	q := `SELECT order_uid, raw_payload, schema_version, updated_at FROM orders ORDER BY updated_at DESC`
 	if limit > 0 {
 		q += fmt.Sprintf(" LIMIT %d", limit)
 	}
@@ -130,16 +528,84 @@ func (p *Postgres) Warmup(ctx context.Context, limit int) (map[string][]byte, er
 	}
 	defer rows.Close()
 
-	out := make(map[string][]byte, 1024)
+	out := make(map[string]StoredOrder, 1024)
 	var id string
 	var raw []byte
+	var schema int
+	var updated time.Time
 	for rows.Next() {
-		if err := rows.Scan(&id, &raw); err != nil {
+		if err := rows.Scan(&id, &raw, &schema, &updated); err != nil {
 			return nil, err
 		}
 		buf := make([]byte, len(raw))
 		copy(buf, raw)
-		out[id] = buf
+		if buf, err = upcast.Order(buf, schema); err != nil {
+			return nil, fmt.Errorf("stored order %s: %w", id, err)
+		}
+		out[id] = StoredOrder{Raw: buf, UpdatedAt: updated}
 	}
 	return out, rows.Err()
 }
+
+// UpcastStored rewrites up to limit orders stored with an older schema
+// version, including their normalized rows, and returns how many it rewrote.
+// Rows locked by a concurrent writer are skipped until the next call.
+func (p *Postgres) UpcastStored(ctx context.Context, limit int) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, `
+SELECT order_uid, raw_payload, schema_version FROM orders
+WHERE schema_version < $1
+ORDER BY order_uid
+LIMIT $2
+FOR UPDATE SKIP LOCKED`, domain.SchemaVersion, limit)
+	if err != nil {
+		return 0, err
+	}
+	type stored struct {
+		id     string
+		raw    []byte
+		schema int
+	}
+	var todo []stored
+	for rows.Next() {
+		var s stored
+		if err := rows.Scan(&s.id, &s.raw, &s.schema); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	b := &pgx.Batch{}
+	var steps []string
+	for _, s := range todo {
+		raw, err := upcast.Order(s.raw, s.schema)
+		if err != nil {
+			return 0, fmt.Errorf("stored order %s: %w", s.id, err)
+		}
+		var o domain.Order
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return 0, fmt.Errorf("decode stored order %s: %w", s.id, err)
+		}
+		if raw, err = codec.Canonical(&o); err != nil {
+			return 0, err
+		}
+		b.Queue(`UPDATE orders SET raw_payload=$2, schema_version=$3 WHERE order_uid=$1`,
+			s.id, json.RawMessage(raw), domain.SchemaVersion)
+		steps = append(steps, "orders upcast "+s.id)
+		steps = queueOrderDetails(b, steps, &o)
+	}
+	if _, err := execBatch(ctx, tx, b, steps); err != nil {
+		return 0, err
+	}
+	return len(todo), tx.Commit(ctx)
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+)
+
+func TestQueueOrderRowStoresCurrentSchemaVersion(t *testing.T) {
+	// Orders decoded by the codecs carry no schema_version; their raw
+	// payload, stamped by codec.Canonical, is what the row holds.
+	rec := OrderWithRaw{Order: &domain.Order{OrderUID: "A"}, Raw: []byte(`{"order_uid":"A","schema_version":2}`)}
+
+	b := &pgx.Batch{}
+	queueOrderRow(b, nil, rec)
+	args := b.QueuedQueries[0].Arguments
+	if got := args[16]; got != domain.SchemaVersion {
+		t.Fatalf("expected schema_version %d, got %v", domain.SchemaVersion, got)
+	}
+
+	b = &pgx.Batch{}
+	(&Postgres{outbox: true}).queueOutboxRow(b, nil, persisted(rec.Order, 1), nil)
+	var ev outboxPayload
+	if err := json.Unmarshal(b.QueuedQueries[0].Arguments[2].(json.RawMessage), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.SchemaVersion != domain.SchemaVersion {
+		t.Fatalf("expected outbox schema_version %d, got %d", domain.SchemaVersion, ev.SchemaVersion)
+	}
+}
+
+func TestPatchedRejectsOrderMadeInvalid(t *testing.T) {
+	raw, err := os.ReadFile("../../model.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPostgres(nil)
+
+	city := "Haifa"
+	o, _, err := p.patched("b563feb7b2b84b6test", raw, domain.SchemaVersion, &domain.DeliveryPatch{City: &city})
+	if err != nil || o.Delivery.City != city {
+		t.Fatalf("expected a valid patch to apply, got %v", err)
+	}
+
+	empty := ""
+	_, _, err = p.patched("b563feb7b2b84b6test", raw, domain.SchemaVersion, &domain.DeliveryPatch{City: &empty})
+	if !errors.Is(err, ErrInvalidOrder) {
+		t.Fatalf("expected ErrInvalidOrder for a blanked required field, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/upcast"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OrderFilter selects orders for ListOrders. Zero fields do not filter.
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Entry           string
+	Locale          string
+	// CreatedFrom and CreatedTo bound date_created: from inclusive, to exclusive.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Currency    string
+	Provider    string
+	Bank        string
+	// Brand and NmID match orders with at least one item having both.
+	Brand string
+	NmID  int64
+}
+
+// OrderCursor is the keyset position of the last order of a page.
+type OrderCursor struct {
+	DateCreated time.Time
+	OrderUID    string
+}
+
+// OrderPage is a page of stored payloads, newest first. Next is nil on the
+// last page.
+type OrderPage struct {
+	Orders [][]byte
+	Next   *OrderCursor
+}
+
+// ListOrders returns up to limit orders matching f, sorted by date_created
+// and order_uid descending, starting after the after cursor when it is set.
+// Keyset pagination keeps pages stable while new orders arrive.
+func (p *Postgres) ListOrders(ctx context.Context, f OrderFilter, after *OrderCursor, limit int) (OrderPage, error) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	eq := func(col, v string) {
+		if v != "" {
+			where = append(where, col+" = "+arg(v))
+		}
+	}
+
+	eq("o.customer_id", f.CustomerID)
+	eq("o.track_number", f.TrackNumber)
+	eq("o.delivery_service", f.DeliveryService)
+	eq("o.entry", f.Entry)
+	eq("o.locale", f.Locale)
+	if !f.CreatedFrom.IsZero() {
+		where = append(where, "o.date_created >= "+arg(f.CreatedFrom))
+	}
+	if !f.CreatedTo.IsZero() {
+		where = append(where, "o.date_created < "+arg(f.CreatedTo))
+	}
+
+	join := ""
+	if f.Currency != "" || f.Provider != "" || f.Bank != "" {
+		join = "JOIN payments p ON p.order_uid = o.order_uid"
+		eq("p.currency", f.Currency)
+		eq("p.provider", f.Provider)
+		eq("p.bank", f.Bank)
+	}
+
+	if f.Brand != "" || f.NmID != 0 {
+		var item []string
+		if f.Brand != "" {
+			item = append(item, "i.brand = "+arg(f.Brand))
+		}
+		if f.NmID != 0 {
+			item = append(item, "i.nm_id = "+arg(f.NmID))
+		}
+		where = append(where, "EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND "+strings.Join(item, " AND ")+")")
+	}
+
+	if after != nil {
+		where = append(where, fmt.Sprintf("(o.date_created, o.order_uid) < (%s, %s)", arg(after.DateCreated), arg(after.OrderUID)))
+	}
+
+	q := "SELECT o.order_uid, o.date_created, o.raw_payload, o.schema_version FROM orders o " + join
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	// One extra row tells whether another page follows.
+	q += " ORDER BY o.date_created DESC, o.order_uid DESC LIMIT " + arg(limit+1)
+
+	rows, err := p.pool.Query(ctx, q, args...)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	defer rows.Close()
+
+	var page OrderPage
+	var last OrderCursor
+	for rows.Next() {
+		if len(page.Orders) == limit {
+			page.Next = &OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID}
+			break
+		}
+		var raw []byte
+		var schema int
+		if err := rows.Scan(&last.OrderUID, &last.DateCreated, &raw, &schema); err != nil {
+			return OrderPage{}, err
+		}
+		if raw, err = upcast.Order(raw, schema); err != nil {
+			return OrderPage{}, fmt.Errorf("stored order %s: %w", last.OrderUID, err)
+		}
+		page.Orders = append(page.Orders, raw)
+	}
+	return page, rows.Err()
+}
+
+// Lookup keys other than order_uid that identify an order.
+type LookupKey string
+
+const (
+	LookupTrackNumber LookupKey = "track_number"
+	LookupTransaction LookupKey = "transaction"
+	LookupRID         LookupKey = "rid"
+)
+
+var lookupQueries = map[LookupKey]string{
+	LookupTrackNumber: `SELECT order_uid FROM orders WHERE track_number = $1 ORDER BY date_created DESC, order_uid DESC LIMIT 1`,
+	LookupTransaction: `
+SELECT o.order_uid FROM payments p JOIN orders o ON o.order_uid = p.order_uid
+WHERE p.transaction = $1 ORDER BY o.date_created DESC, o.order_uid DESC LIMIT 1`,
+	LookupRID: `
+SELECT o.order_uid FROM items i JOIN orders o ON o.order_uid = i.order_uid
+WHERE i.rid = $1 ORDER BY o.date_created DESC, o.order_uid DESC LIMIT 1`,
+}
+
+// LookupOrderUID returns the order_uid of the order with the given track
+// number, payment transaction or item rid, the newest one when several match,
+// or ErrNotFound.
+func (p *Postgres) LookupOrderUID(ctx context.Context, key LookupKey, value string) (string, error) {
+	q, ok := lookupQueries[key]
+	if !ok {
+		return "", fmt.Errorf("unknown lookup key %q", key)
+	}
+	var id string
+	err := p.pool.QueryRow(ctx, q, value).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%s %s: %w", key, value, ErrNotFound)
+	}
+	return id, err
+}
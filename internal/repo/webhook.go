@@ -0,0 +1,236 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+)
+
+// ErrWebhookNotFound is returned for an unknown webhook subscription.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription is a partner endpoint notified about order changes.
+// An empty Events list subscribes to every event type. Orders in its
+// payloads are masked for Role.
+type WebhookSubscription struct {
+	ID        int64
+	URL       string
+	Secret    string
+	Events    []string
+	Role      pii.Role
+	Active    bool
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is one event queued for one subscription; it doubles as the
+// delivery log. Payload holds the order unmasked. URL, Secret and Role are
+// only set on claimed deliveries.
+type WebhookDelivery struct {
+	ID             int64
+	SubscriptionID int64
+	URL            string
+	Secret         string
+	Role           pii.Role
+	OrderUID       string
+	Event          string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatus     int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// WebhookAttempt is the outcome of one delivery attempt. A failed attempt
+// with a zero RetryAt gives the delivery up.
+type WebhookAttempt struct {
+	StatusCode int
+	Err        string
+	Delivered  bool
+	RetryAt    time.Time
+}
+
+// webhookPayload is the body POSTed to subscribers.
+type webhookPayload struct {
+	Event      string          `json:"event"`
+	OrderUID   string          `json:"order_uid"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Order      json.RawMessage `json:"order,omitempty"`
+}
+
+// WithWebhooks makes every applied write queue a delivery for each webhook
+// subscription interested in the event, in the same transaction.
+func WithWebhooks() Option {
+	return func(p *Postgres) { p.webhooks = true }
+}
+
+// queueWebhookDeliveries queues event about order id for the matching
+// subscriptions when webhooks are enabled; order is the stored JSON, nil for
+// deletions. One statement inserts a delivery per matching subscription and
+// none when nobody is subscribed. The order is queued unmasked: the
+// dispatcher masks it for the role of each subscription when sending, so a
+// write does not render it once per role.
+func (p *Postgres) queueWebhookDeliveries(b *pgx.Batch, steps []string, event, id string, order []byte) []string {
+	if !p.webhooks {
+		return steps
+	}
+	payload, _ := json.Marshal(webhookPayload{Event: event, OrderUID: id, OccurredAt: time.Now().UTC(), Order: order})
+	b.Queue(`
+INSERT INTO webhook_deliveries (subscription_id, order_uid, event_type, payload)
+SELECT id, $1, $2, $3 FROM webhook_subscriptions
+WHERE cardinality(events) = 0 OR $2 = ANY(events)`, id, event, json.RawMessage(payload))
+	return append(steps, "webhook deliveries insert "+id)
+}
+
+func (p *Postgres) CreateWebhook(ctx context.Context, s WebhookSubscription) (WebhookSubscription, error) {
+	if s.Events == nil {
+		s.Events = []string{}
+	}
+	if s.Role == "" {
+		s.Role = pii.RoleSupport
+	}
+	err := p.pool.QueryRow(ctx, `
+INSERT INTO webhook_subscriptions (url, secret, events, role, active)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING id, created_at`, s.URL, s.Secret, s.Events, s.Role, s.Active).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return WebhookSubscription{}, fmt.Errorf("webhook insert: %w", err)
+	}
+	return s, nil
+}
+
+func (p *Postgres) ListWebhooks(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := p.pool.Query(ctx, `SELECT id, url, secret, events, role, active, created_at FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanWebhook)
+}
+
+// GetWebhook returns subscription id or ErrWebhookNotFound.
+func (p *Postgres) GetWebhook(ctx context.Context, id int64) (WebhookSubscription, error) {
+	rows, err := p.pool.Query(ctx, `SELECT id, url, secret, events, role, active, created_at FROM webhook_subscriptions WHERE id=$1`, id)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	s, err := pgx.CollectExactlyOneRow(rows, scanWebhook)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WebhookSubscription{}, fmt.Errorf("webhook %d: %w", id, ErrWebhookNotFound)
+	}
+	return s, err
+}
+
+func scanWebhook(row pgx.CollectableRow) (WebhookSubscription, error) {
+	var s WebhookSubscription
+	err := row.Scan(&s.ID, &s.URL, &s.Secret, &s.Events, &s.Role, &s.Active, &s.CreatedAt)
+	return s, err
+}
+
+// SetWebhookActive pauses or resumes subscription id. Deliveries of a paused
+// subscription keep queueing and are sent once it is resumed.
+func (p *Postgres) SetWebhookActive(ctx context.Context, id int64, active bool) error {
+	tag, err := p.pool.Exec(ctx, `UPDATE webhook_subscriptions SET active=$2, updated_at=now() WHERE id=$1`, id, active)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("webhook %d: %w", id, ErrWebhookNotFound)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries of subscription id, newest first.
+func (p *Postgres) ListWebhookDeliveries(ctx context.Context, id int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := p.pool.Query(ctx, `
+SELECT id, subscription_id, order_uid, event_type, payload, status, attempts, next_attempt_at,
+       COALESCE(last_status, 0), COALESCE(last_error, ''), created_at, delivered_at
+FROM webhook_deliveries
+WHERE subscription_id=$1
+ORDER BY id DESC
+LIMIT $2`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (WebhookDelivery, error) {
+		var d WebhookDelivery
+		err := row.Scan(&d.ID, &d.SubscriptionID, &d.OrderUID, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		return d, err
+	})
+}
+
+// ClaimWebhookDeliveries returns up to limit due deliveries of active
+// subscriptions and postpones them by lease, so that concurrent dispatchers
+// skip them while they are being sent. A dispatcher that dies mid-way leaves
+// them to be retried once the lease expires.
+func (p *Postgres) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	rows, err := p.pool.Query(ctx, `
+UPDATE webhook_deliveries d
+SET next_attempt_at = now() + $2 * interval '1 microsecond'
+FROM webhook_subscriptions s
+WHERE s.id = d.subscription_id AND d.id IN (
+  SELECT d2.id FROM webhook_deliveries d2
+  JOIN webhook_subscriptions s2 ON s2.id = d2.subscription_id
+  WHERE d2.status = 'pending' AND d2.next_attempt_at <= now() AND s2.active
+  ORDER BY d2.next_attempt_at, d2.id
+  LIMIT $1
+  FOR UPDATE OF d2 SKIP LOCKED
+)
+RETURNING d.id, d.subscription_id, s.url, s.secret, s.role, d.order_uid, d.event_type, d.payload, d.attempts, d.created_at`,
+		limit, lease.Microseconds())
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (WebhookDelivery, error) {
+		d := WebhookDelivery{Status: DeliveryPending}
+		err := row.Scan(&d.ID, &d.SubscriptionID, &d.URL, &d.Secret, &d.Role, &d.OrderUID, &d.Event, &d.Payload, &d.Attempts, &d.CreatedAt)
+		return d, err
+	})
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt to send delivery id.
+func (p *Postgres) RecordWebhookAttempt(ctx context.Context, id int64, a WebhookAttempt) error {
+	status := DeliveryPending
+	switch {
+	case a.Delivered:
+		status = DeliveryDelivered
+	case a.RetryAt.IsZero():
+		status = DeliveryFailed
+	}
+	var lastStatus *int
+	if a.StatusCode != 0 {
+		lastStatus = &a.StatusCode
+	}
+	var lastErr *string
+	if a.Err != "" {
+		lastErr = &a.Err
+	}
+	_, err := p.pool.Exec(ctx, `
+UPDATE webhook_deliveries SET
+  status = $2,
+  attempts = attempts + 1,
+  last_status = $3,
+  last_error = $4,
+  next_attempt_at = CASE WHEN $2 = 'pending' THEN $5 ELSE next_attempt_at END,
+  delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+WHERE id = $1`, id, status, lastStatus, lastErr, a.RetryAt)
+	if err != nil {
+		return fmt.Errorf("webhook delivery %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package upcast
+
+// v1ToV2 upgrades unversioned payloads (see model.json). Version 2 differs from
+// version 1 only by the schema_version field, which Upcast stamps after every
+// step, so there is nothing else to rewrite. The step still has to exist: it
+// makes payloads without the field version 1 and the current one 2, so the
+// first real change to the schema is a v2ToV3 step.
+func v1ToV2(map[string]any) error { return nil }
@@ -0,0 +1,102 @@
+// Package upcast rewrites order payloads written against older schema
+// versions into the current domain.SchemaVersion.
+//
+// A payload carries its version in the schema_version field; payloads without
+// it predate versioning and are version 1. Upcasters work on the decoded JSON
+// document, one version step at a time, so renames and type changes are
+// expressed without keeping old copies of domain.Order around.
+package upcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+)
+
+// ErrUnknownVersion is returned for payloads newer than the chain knows.
+var ErrUnknownVersion = errors.New("unknown schema version")
+
+// Upcaster rewrites a document of one schema version into the next one.
+// Numbers are json.Number so amounts survive without float rounding.
+type Upcaster func(doc map[string]any) error
+
+// Chain upcasts documents to its current version. The upcaster at index i
+// turns version i+1 into i+2, so the current version is len(steps)+1.
+type Chain struct {
+	steps []Upcaster
+}
+
+func NewChain(steps ...Upcaster) *Chain { return &Chain{steps: steps} }
+
+// Current is the version Upcast produces.
+func (c *Chain) Current() int { return len(c.steps) + 1 }
+
+// Upcast returns raw rewritten to the current version. version is the schema
+// version of raw; zero means it is read from raw itself. Payloads that are
+// already current are returned unchanged.
+func (c *Chain) Upcast(raw []byte, version int) ([]byte, error) {
+	if version == 0 {
+		v, err := Version(raw)
+		if err != nil {
+			return nil, err
+		}
+		version = v
+	}
+	if version < 1 || version > c.Current() {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	if version == c.Current() {
+		return raw, nil
+	}
+
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("upcast from v%d: %w", version, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("upcast from v%d: payload is not an object", version)
+	}
+	for v := version; v < c.Current(); v++ {
+		if err := c.steps[v-1](doc); err != nil {
+			return nil, fmt.Errorf("upcast v%d to v%d: %w", v, v+1, err)
+		}
+		doc["schema_version"] = v + 1
+	}
+	return json.Marshal(doc)
+}
+
+// Version returns the schema_version of raw, 1 when the field is absent.
+func Version(raw []byte) (int, error) {
+	var v struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	if v.SchemaVersion == nil {
+		return 1, nil
+	}
+	return *v.SchemaVersion, nil
+}
+
+// orders upcasts order snapshots to domain.SchemaVersion.
+var orders = NewChain(
+	v1ToV2,
+)
+
+// Order upcasts an order snapshot of the given version (zero: read from the
+// payload) to domain.SchemaVersion.
+func Order(raw []byte, version int) ([]byte, error) {
+	return orders.Upcast(raw, version)
+}
+
+func init() {
+	if orders.Current() != domain.SchemaVersion {
+		panic(fmt.Sprintf("upcast: chain ends at v%d, domain.Order is v%d", orders.Current(), domain.SchemaVersion))
+	}
+}
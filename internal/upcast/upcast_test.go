@@ -0,0 +1,149 @@
+package upcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+	"github.com/kosovrzn/wb-tech-l0/internal/validation"
+)
+
+// Every upcaster has fixtures in testdata/v<N>; each file there must turn into
+// the file of the same name in testdata/v<N+1>.
+func TestOrderUpcasters(t *testing.T) {
+	for i, step := range orders.steps {
+		from := i + 1
+		files, err := filepath.Glob(filepath.Join("testdata", fmt.Sprintf("v%d", from), "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("no fixtures for the v%d upcaster", from)
+		}
+		for _, in := range files {
+			name := fmt.Sprintf("v%d/%s", from, filepath.Base(in))
+			t.Run(name, func(t *testing.T) {
+				doc := decode(t, readFile(t, in))
+				if err := step(doc); err != nil {
+					t.Fatalf("upcast: %v", err)
+				}
+				doc["schema_version"] = json.Number(fmt.Sprint(from + 1))
+
+				out := filepath.Join("testdata", fmt.Sprintf("v%d", from+1), filepath.Base(in))
+				if want := decode(t, readFile(t, out)); !reflect.DeepEqual(doc, want) {
+					got, _ := json.MarshalIndent(doc, "", "  ")
+					t.Fatalf("unexpected result, want %s\n got %s", out, got)
+				}
+			})
+		}
+	}
+}
+
+func TestOrderUpcastsEveryFixtureToValidOrder(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "v*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := validation.New()
+	for _, in := range files {
+		t.Run(in, func(t *testing.T) {
+			raw, err := Order(readFile(t, in), 0)
+			if err != nil {
+				t.Fatalf("upcast: %v", err)
+			}
+			var o domain.Order
+			if err := json.Unmarshal(raw, &o); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if o.SchemaVersion != domain.SchemaVersion {
+				t.Fatalf("expected schema_version %d, got %d", domain.SchemaVersion, o.SchemaVersion)
+			}
+			if err := v.ValidateOrder(&o); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	// v2 renames shardkey, v3 moves amounts to decimal strings.
+	c := NewChain(
+		func(doc map[string]any) error {
+			doc["shard_key"] = doc["shardkey"]
+			delete(doc, "shardkey")
+			return nil
+		},
+		func(doc map[string]any) error {
+			p, ok := doc["payment"].(map[string]any)
+			if !ok {
+				return errors.New("no payment")
+			}
+			n, ok := p["amount"].(json.Number)
+			if !ok {
+				return errors.New("amount is not a number")
+			}
+			p["amount"] = n.String() + ".00"
+			return nil
+		},
+	)
+	if c.Current() != 3 {
+		t.Fatalf("expected current version 3, got %d", c.Current())
+	}
+
+	cases := []struct {
+		name    string
+		in      string
+		version int
+		want    string
+	}{
+		{"v1 from payload", `{"shardkey":"9","payment":{"amount":9007199254740993}}`, 0,
+			`{"payment":{"amount":"9007199254740993.00"},"schema_version":3,"shard_key":"9"}`},
+		{"v2 from header", `{"shard_key":"9","payment":{"amount":1817}}`, 2,
+			`{"payment":{"amount":"1817.00"},"schema_version":3,"shard_key":"9"}`},
+		{"current is untouched", `{"schema_version":3, "shard_key":"9"}`, 0, `{"schema_version":3, "shard_key":"9"}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := c.Upcast([]byte(tc.in), tc.version)
+			if err != nil {
+				t.Fatalf("upcast: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := c.Upcast([]byte(`{"schema_version":4}`), 0); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("expected ErrUnknownVersion, got %v", err)
+	}
+	if _, err := c.Upcast([]byte(`{"shardkey":"9"}`), 1); err == nil {
+		t.Fatalf("expected failing upcaster to surface an error")
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func decode(t *testing.T, b []byte) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
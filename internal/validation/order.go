@@ -22,14 +22,33 @@ func (v *Validator) ValidateOrder(o *domain.Order) error {
 	if o == nil {
 		return fmt.Errorf("order is nil")
 	}
+	return v.check(o, "order")
+}
+
+// ValidatePatch checks a partial order update.
+func (v *Validator) ValidatePatch(p domain.Patch) error {
+	if p == nil {
+		return fmt.Errorf("patch is nil")
+	}
+	return v.check(p, "event")
+}
+
+// ValidateOrderUID checks an order_uid taken from outside a payload, such as a message key.
+func (v *Validator) ValidateOrderUID(id string) error {
+	if err := v.validate.Var(id, "required,alphanumunicode,max=64"); err != nil {
+		return fmt.Errorf("invalid order_uid %q", id)
+	}
+	return nil
+}
 
-	if err := v.validate.Struct(o); err != nil {
+func (v *Validator) check(s any, what string) error {
+	if err := v.validate.Struct(s); err != nil {
 		if invalid, ok := err.(*validator.InvalidValidationError); ok {
 			return invalid
 		}
 		if verrs, ok := err.(validator.ValidationErrors); ok {
 			var b strings.Builder
-			b.WriteString("order validation failed: ")
+			b.WriteString(what + " validation failed: ")
 			for i, fe := range verrs {
 				if i > 0 {
 					b.WriteString("; ")
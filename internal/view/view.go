@@ -0,0 +1,211 @@
+// Package view projects orders to the subset of fields a client asked for,
+// either as a list of field paths or as a named view.
+package view
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/domain"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+)
+
+// views are the named projections, by the team they are meant for.
+var views = map[string][]string{
+	"summary": {
+		"order_uid", "track_number", "date_created", "locale", "customer_id", "cancelled_at",
+		"payment.amount", "payment.currency",
+		"items.name", "items.brand", "items.total_price", "items.status",
+	},
+	"logistics": {
+		"order_uid", "track_number", "entry", "delivery_service", "shardkey", "sm_id", "oof_shard", "date_created",
+		"delivery.name", "delivery.zip", "delivery.city", "delivery.address", "delivery.region",
+		"items.chrt_id", "items.track_number", "items.rid", "items.size", "items.status",
+	},
+	"finance": {
+		"order_uid", "customer_id", "date_created", "cancelled_at",
+		"payment",
+		"items.chrt_id", "items.nm_id", "items.price", "items.sale", "items.total_price",
+	},
+}
+
+// node is a tree of selected fields; a nil node selects the whole value.
+type node map[string]node
+
+// schema holds every field path of domain.Order.
+var schema = describe(reflect.TypeOf(domain.Order{}))
+
+// Projection selects fields of an order.
+type Projection struct {
+	root node
+}
+
+// Fields returns the projection of a comma-separated list of dotted field
+// paths, e.g. "order_uid,delivery.city,items.name". A path into a list
+// selects the field of every element.
+func Fields(list string) (*Projection, error) {
+	root := node{}
+	for _, path := range strings.Split(list, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if err := root.add(path); err != nil {
+			return nil, err
+		}
+	}
+	if len(root) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+	return &Projection{root: root}, nil
+}
+
+// Named returns the projection of one of Names.
+func Named(name string) (*Projection, error) {
+	paths, ok := views[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown view %q, want one of %s", name, strings.Join(Names(), ", "))
+	}
+	return Fields(strings.Join(paths, ","))
+}
+
+// Names lists the named views.
+func Names() []string {
+	names := make([]string, 0, len(views))
+	for name := range views {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// String returns the selected paths sorted and comma-separated, the same for
+// every spelling of the projection.
+func (p *Projection) String() string {
+	var paths []string
+	p.root.paths("", &paths)
+	slices.Sort(paths)
+	return strings.Join(paths, ",")
+}
+
+func (n node) paths(prefix string, out *[]string) {
+	for k, child := range n {
+		if child == nil {
+			*out = append(*out, prefix+k)
+			continue
+		}
+		child.paths(prefix+k+".", out)
+	}
+}
+
+// add selects path, which must exist in the schema.
+func (n node) add(path string) error {
+	parts := strings.Split(path, ".")
+	cur, def := n, schema
+	for i, part := range parts {
+		sub, ok := def[part]
+		if !ok {
+			return fmt.Errorf("unknown field %q", strings.Join(parts[:i+1], "."))
+		}
+		child, selected := cur[part]
+		if selected && child == nil {
+			// An ancestor was selected whole already.
+			return nil
+		}
+		if i == len(parts)-1 {
+			cur[part] = nil
+			return nil
+		}
+		if sub == nil {
+			return fmt.Errorf("field %q has no subfields", strings.Join(parts[:i+1], "."))
+		}
+		if child == nil {
+			child = node{}
+			cur[part] = child
+		}
+		cur, def = child, sub
+	}
+	return nil
+}
+
+// Apply decodes raw as a domain.Order and returns the JSON of the selected
+// fields.
+func (p *Projection) Apply(raw []byte) ([]byte, error) {
+	return Render(raw, p, pii.RolePrivileged)
+}
+
+// Render returns order raw with its personal data masked for role r and
+// projected by p; a nil p selects the whole order. A privileged role gets the
+// whole order as is.
+func Render(raw []byte, p *Projection, r pii.Role) ([]byte, error) {
+	if p == nil && r == pii.RolePrivileged {
+		return raw, nil
+	}
+	var o domain.Order
+	if err := json.Unmarshal(raw, &o); err != nil {
+		return nil, err
+	}
+	o.MaskPII(r)
+	if p == nil {
+		return json.Marshal(&o)
+	}
+	full, err := json.Marshal(&o)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(full))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(prune(v, p.root))
+}
+
+func prune(v any, n node) any {
+	if n == nil {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(n))
+		for k, child := range n {
+			if val, ok := v[k]; ok {
+				out[k] = prune(val, child)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, el := range v {
+			out[i] = prune(el, n)
+		}
+		return out
+	}
+	return v
+}
+
+// describe returns the field tree of t by its json tags; leaves are nil.
+func describe(t reflect.Type) node {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	n := node{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		n[name] = describe(f.Type)
+	}
+	return n
+}
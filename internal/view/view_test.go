@@ -0,0 +1,74 @@
+package view_test
+
+import (
+	"testing"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/view"
+)
+
+const order = `{"order_uid":"A","track_number":"T","entry":"WBIL",
+"delivery":{"name":"N","phone":"+9720000000","zip":"1","city":"Kiryat Mozkin","address":"Ploshad Mira 15","region":"Kraiot","email":"t@gmail.com"},
+"payment":{"transaction":"A","request_id":"","currency":"USD","provider":"wbpay","amount":1817,"payment_dt":1637907727,"bank":"alpha","delivery_cost":1500,"goods_total":317,"custom_fee":0},
+"items":[{"chrt_id":1,"track_number":"T","price":453,"rid":"R1","name":"Mascaras","sale":30,"size":"0","total_price":317,"nm_id":2,"brand":"Vivienne Sabo","status":202},
+{"chrt_id":2,"track_number":"T","price":10,"rid":"R2","name":"Brush","sale":0,"size":"0","total_price":10,"nm_id":3,"brand":"B","status":202}],
+"locale":"en","internal_signature":"","customer_id":"test","delivery_service":"meest","shardkey":"9","sm_id":99,
+"date_created":"2021-11-26T06:22:19Z","oof_shard":"1"}`
+
+func TestFieldsSelectNestedAndListFields(t *testing.T) {
+	p, err := view.Fields("order_uid, delivery.city,items.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Apply([]byte(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"delivery":{"city":"Kiryat Mozkin"},"items":[{"name":"Mascaras"},{"name":"Brush"}],"order_uid":"A"}`
+	if string(got) != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestFieldsWholeObjectWinsOverSubfields(t *testing.T) {
+	p, err := view.Fields("payment.amount,payment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Apply([]byte(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"payment":{"amount":1817,"bank":"alpha","currency":"USD","custom_fee":0,"delivery_cost":1500,"goods_total":317,"payment_dt":1637907727,"provider":"wbpay","request_id":"","transaction":"A"}}`
+	if string(got) != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestFieldsRejectsUnknownPaths(t *testing.T) {
+	for _, fields := range []string{"", "nope", "delivery.nope", "order_uid.x", "items.name.x"} {
+		if _, err := view.Fields(fields); err == nil {
+			t.Errorf("fields %q: expected an error", fields)
+		}
+	}
+}
+
+func TestNamedViews(t *testing.T) {
+	for _, name := range view.Names() {
+		p, err := view.Named(name)
+		if err != nil {
+			t.Fatalf("view %s: %v", name, err)
+		}
+		if _, err := p.Apply([]byte(order)); err != nil {
+			t.Fatalf("view %s: %v", name, err)
+		}
+	}
+	p, _ := view.Named("summary")
+	got, _ := p.Apply([]byte(order))
+	want := `{"customer_id":"test","date_created":"2021-11-26T06:22:19Z","items":[{"brand":"Vivienne Sabo","name":"Mascaras","status":202,"total_price":317},{"brand":"B","name":"Brush","status":202,"total_price":10}],"locale":"en","order_uid":"A","payment":{"amount":1817,"currency":"USD"},"track_number":"T"}`
+	if string(got) != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if _, err := view.Named("nope"); err == nil {
+		t.Fatal("expected an error for an unknown view")
+	}
+}
@@ -0,0 +1,253 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/httpapi"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+// knownEvents are the event types a subscription may filter on.
+var knownEvents = map[string]bool{
+	repo.EventOrderPersisted: true,
+	repo.EventOrderDeleted:   true,
+}
+
+type createRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Role   pii.Role `json:"role"`
+}
+
+type subscription struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Role      pii.Role  `json:"role"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type delivery struct {
+	ID            int64           `json:"id"`
+	OrderUID      string          `json:"order_uid"`
+	Event         string          `json:"event"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatus    int             `json:"last_status,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type testResult struct {
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewAdminHandler serves the subscription management API under
+// /admin/webhooks. Secrets are only returned by the create call.
+func NewAdminHandler(store Store, d *Dispatcher) http.Handler {
+	mux := http.NewServeMux()
+	allowPrivate := d != nil && d.cfg.AllowPrivateTargets
+
+	mux.HandleFunc("POST /admin/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		var req createRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpapi.WriteError(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := validate(&req, allowPrivate); err != nil {
+			httpapi.WriteError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		s, err := store.CreateWebhook(r.Context(), repo.WebhookSubscription{URL: req.URL, Secret: req.Secret, Events: req.Events, Role: req.Role, Active: true})
+		if err != nil {
+			log.Printf("webhook create: %v", err)
+			httpapi.WriteError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusCreated, toSubscription(s, true))
+	})
+
+	mux.HandleFunc("GET /admin/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		subs, err := store.ListWebhooks(r.Context())
+		if err != nil {
+			log.Printf("webhook list: %v", err)
+			httpapi.WriteError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		out := make([]subscription, len(subs))
+		for i, s := range subs {
+			out[i] = toSubscription(s, false)
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+
+	setActive := func(active bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id, ok := pathID(w, r)
+			if !ok {
+				return
+			}
+			if err := store.SetWebhookActive(r.Context(), id, active); err != nil {
+				storeError(w, r, "webhook set active", err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+	mux.HandleFunc("POST /admin/webhooks/{id}/pause", setActive(false))
+	mux.HandleFunc("POST /admin/webhooks/{id}/resume", setActive(true))
+
+	mux.HandleFunc("POST /admin/webhooks/{id}/test", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		s, err := store.GetWebhook(r.Context(), id)
+		if err != nil {
+			storeError(w, r, "webhook get", err)
+			return
+		}
+		body, _ := json.Marshal(map[string]any{"event": EventTest, "subscription_id": s.ID, "occurred_at": time.Now().UTC()})
+		deliveryID := "test-" + randomHex(8)
+		status, err := d.Send(r.Context(), s.URL, s.Secret, EventTest, deliveryID, body)
+		res := testResult{Delivered: err == nil, StatusCode: status}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		writeJSON(w, http.StatusOK, res)
+	})
+
+	mux.HandleFunc("GET /admin/webhooks/{id}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		limit := 50
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 500 {
+				httpapi.WriteError(w, r, http.StatusBadRequest, "limit must be between 1 and 500")
+				return
+			}
+			limit = n
+		}
+		s, err := store.GetWebhook(r.Context(), id)
+		if err != nil {
+			storeError(w, r, "webhook get", err)
+			return
+		}
+		dels, err := store.ListWebhookDeliveries(r.Context(), id, limit)
+		if err != nil {
+			storeError(w, r, "webhook deliveries", err)
+			return
+		}
+		out := make([]delivery, len(dels))
+		for i, d := range dels {
+			out[i] = toDelivery(d, s.Role)
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+
+	return mux
+}
+
+func validate(req *createRequest, allowPrivate bool) error {
+	if err := ValidateTarget(req.URL, allowPrivate); err != nil {
+		return err
+	}
+	for _, e := range req.Events {
+		if !knownEvents[e] {
+			return errors.New("unknown event " + strconv.Quote(e))
+		}
+	}
+	if req.Role == "" {
+		req.Role = pii.RoleSupport
+	} else if _, err := pii.ParseRole(string(req.Role)); err != nil {
+		return err
+	}
+	if req.Secret == "" {
+		req.Secret = randomHex(32)
+	}
+	return nil
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpapi.WriteError(w, r, http.StatusBadRequest, "invalid webhook id")
+		return 0, false
+	}
+	return id, true
+}
+
+func storeError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, repo.ErrWebhookNotFound):
+		httpapi.WriteError(w, r, http.StatusNotFound, "webhook not found")
+	case errors.Is(err, context.Canceled):
+		// The client went away; nobody reads the answer.
+	default:
+		log.Printf("%s: %v", op, err)
+		httpapi.WriteError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func toSubscription(s repo.WebhookSubscription, withSecret bool) subscription {
+	out := subscription{ID: s.ID, URL: s.URL, Events: s.Events, Role: s.Role, Active: s.Active, CreatedAt: s.CreatedAt}
+	if out.Events == nil {
+		out.Events = []string{}
+	}
+	if withSecret {
+		out.Secret = s.Secret
+	}
+	return out
+}
+
+// toDelivery shows d with its order masked for role, as it is sent.
+func toDelivery(d repo.WebhookDelivery, role pii.Role) delivery {
+	out := delivery{
+		ID:          d.ID,
+		OrderUID:    d.OrderUID,
+		Event:       d.Event,
+		Status:      d.Status,
+		Attempts:    d.Attempts,
+		LastStatus:  d.LastStatus,
+		LastError:   d.LastError,
+		CreatedAt:   d.CreatedAt,
+		DeliveredAt: d.DeliveredAt,
+		Payload:     maskPayload(d.Payload, role),
+	}
+	if d.Status == repo.DeliveryPending {
+		out.NextAttemptAt = &d.NextAttemptAt
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
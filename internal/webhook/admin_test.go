@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func TestAdmin_CreateGeneratesSecretAndListHidesIt(t *testing.T) {
+	var stored repo.WebhookSubscription
+	store := &mocks.WebhookStoreMock{
+		CreateWebhookFunc: func(ctx context.Context, s repo.WebhookSubscription) (repo.WebhookSubscription, error) {
+			s.ID = 1
+			stored = s
+			return s, nil
+		},
+		ListWebhooksFunc: func(ctx context.Context) ([]repo.WebhookSubscription, error) {
+			return []repo.WebhookSubscription{stored}, nil
+		},
+	}
+	h := NewAdminHandler(store, NewDispatcher(store, nil, DefaultConfig()))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/webhooks",
+		strings.NewReader(`{"url":"https://partner.example/hook","events":["order.deleted"]}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rr.Code, rr.Body)
+	}
+	var created subscription
+	_ = json.Unmarshal(rr.Body.Bytes(), &created)
+	if created.Secret == "" || created.Secret != stored.Secret || !stored.Active || stored.Role != pii.RoleSupport {
+		t.Fatalf("unexpected subscription: %+v, stored %+v", created, stored)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil))
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), stored.Secret) {
+		t.Fatalf("list: %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestAdmin_CreateRejectsInvalidInput(t *testing.T) {
+	h := NewAdminHandler(&mocks.WebhookStoreMock{}, nil)
+	for _, body := range []string{
+		`{"url":"ftp://partner.example"}`,
+		`{"url":"/relative"}`,
+		`{"url":"https://user:pw@partner.example"}`,
+		`{"url":"http://localhost:8080/hook"}`,
+		`{"url":"http://127.0.0.1/hook"}`,
+		`{"url":"http://[::1]/hook"}`,
+		`{"url":"http://10.1.2.3/hook"}`,
+		`{"url":"http://169.254.169.254/latest/meta-data"}`,
+		`{"url":"https://partner.example","events":["order.shipped"]}`,
+		`{"url":"https://partner.example","role":"root"}`,
+		`not json`,
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/webhooks", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	d := NewDispatcher(&mocks.WebhookStoreMock{}, nil, DefaultConfig())
+	if _, err := d.Send(context.Background(), srv.URL, "s", EventTest, "1", []byte(`{}`)); !errors.Is(err, ErrForbiddenTarget) {
+		t.Fatalf("expected ErrForbiddenTarget, got %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.AllowPrivateTargets = true
+	d = NewDispatcher(&mocks.WebhookStoreMock{}, nil, cfg)
+	if _, err := d.Send(context.Background(), srv.URL, "s", EventTest, "1", []byte(`{}`)); err != nil {
+		t.Fatalf("allowed private target: %v", err)
+	}
+}
+
+func TestAdmin_PauseUnknownSubscription(t *testing.T) {
+	store := &mocks.WebhookStoreMock{
+		SetWebhookActiveFunc: func(ctx context.Context, id int64, active bool) error {
+			return fmt.Errorf("webhook %d: %w", id, repo.ErrWebhookNotFound)
+		},
+	}
+	rr := httptest.NewRecorder()
+	NewAdminHandler(store, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/webhooks/42/pause", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d", rr.Code)
+	}
+	if calls := store.SetWebhookActiveCalls(); len(calls) != 1 || calls[0].ID != 42 || calls[0].Active {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+}
+
+func TestAdmin_TestSendsSignedPing(t *testing.T) {
+	var event string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event = r.Header.Get(HeaderEvent)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	store := &mocks.WebhookStoreMock{
+		GetWebhookFunc: func(ctx context.Context, id int64) (repo.WebhookSubscription, error) {
+			return repo.WebhookSubscription{ID: id, URL: srv.URL, Secret: "s", CreatedAt: time.Now()}, nil
+		},
+	}
+	rr := httptest.NewRecorder()
+	NewAdminHandler(store, NewDispatcher(store, srv.Client(), DefaultConfig())).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/webhooks/3/test", nil))
+
+	var res testResult
+	_ = json.Unmarshal(rr.Body.Bytes(), &res)
+	if rr.Code != http.StatusOK || !res.Delivered || res.StatusCode != http.StatusNoContent || event != EventTest {
+		t.Fatalf("got %d %+v event=%q", rr.Code, res, event)
+	}
+}
@@ -0,0 +1,265 @@
+// Package webhook notifies partner endpoints about order changes with signed
+// HTTP callbacks. Deliveries are queued by repo in the transaction that
+// changed the order and sent by a Dispatcher.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+	"github.com/kosovrzn/wb-tech-l0/internal/view"
+)
+
+// Headers set on every callback.
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+// EventTest is the event type of the callbacks sent by the test endpoint.
+const EventTest = "webhook.test"
+
+//go:generate moq -pkg mocks -skip-ensure -out ../mocks/webhook_store_mock.go . Store:WebhookStoreMock
+
+// Store is the webhook side of the repository.
+type Store interface {
+	CreateWebhook(ctx context.Context, s repo.WebhookSubscription) (repo.WebhookSubscription, error)
+	ListWebhooks(ctx context.Context) ([]repo.WebhookSubscription, error)
+	GetWebhook(ctx context.Context, id int64) (repo.WebhookSubscription, error)
+	SetWebhookActive(ctx context.Context, id int64, active bool) error
+	ListWebhookDeliveries(ctx context.Context, id int64, limit int) ([]repo.WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]repo.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id int64, a repo.WebhookAttempt) error
+}
+
+// Config tunes the dispatcher.
+type Config struct {
+	// BatchSize is the maximum number of deliveries claimed at once.
+	BatchSize int
+	// Concurrency is the number of callbacks sent in parallel.
+	Concurrency int
+	// PollInterval is the pause after no delivery was due.
+	PollInterval time.Duration
+	// Timeout bounds one callback.
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts before a delivery is given up.
+	MaxAttempts int
+	// InitialBackoff is the pause after the first failed attempt; it doubles
+	// with every further failure up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// AllowPrivateTargets lets subscriptions call loopback and private
+	// addresses, for development only.
+	AllowPrivateTargets bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:      50,
+		Concurrency:    8,
+		PollInterval:   time.Second,
+		Timeout:        10 * time.Second,
+		MaxAttempts:    10,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     time.Hour,
+	}
+}
+
+// Dispatcher sends queued deliveries with at-least-once semantics: a delivery
+// is marked delivered only after the subscriber answered 2xx, so receivers
+// should deduplicate by the X-Webhook-Delivery header.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    Config
+	now    func() time.Time
+}
+
+func NewDispatcher(store Store, client *http.Client, cfg Config) *Dispatcher {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if client == nil {
+		client = NewClient(cfg.AllowPrivateTargets)
+	}
+	return &Dispatcher{store: store, client: client, cfg: cfg, now: time.Now}
+}
+
+// Run sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		n, err := d.dispatch(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("webhook dispatch warn: %v", err)
+		}
+		if err == nil && n == d.cfg.BatchSize {
+			// A full batch: more deliveries are likely due.
+			continue
+		}
+		t := time.NewTimer(d.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// dispatch sends one batch of due deliveries and returns its size.
+func (d *Dispatcher) dispatch(ctx context.Context) (int, error) {
+	// The lease outlives the slowest possible batch, so a delivery is not
+	// claimed again while it is still being sent.
+	rounds := (d.cfg.BatchSize + d.cfg.Concurrency - 1) / d.cfg.Concurrency
+	lease := time.Duration(rounds+1) * d.cfg.Timeout
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.cfg.BatchSize, lease)
+	if err != nil {
+		return 0, fmt.Errorf("claim deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, d.cfg.Concurrency)
+	for _, del := range deliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			d.deliver(ctx, del)
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del repo.WebhookDelivery) {
+	status, err := d.Send(ctx, del.URL, del.Secret, del.Event, strconv.FormatInt(del.ID, 10), maskPayload(del.Payload, del.Role))
+	a := repo.WebhookAttempt{StatusCode: status, Delivered: err == nil}
+	if err != nil {
+		a.Err = err.Error()
+		if attempt := del.Attempts + 1; attempt < d.cfg.MaxAttempts {
+			a.RetryAt = d.now().Add(d.backoff(attempt))
+		} else {
+			log.Printf("webhook delivery %d to subscription %d failed after %d attempts: %v", del.ID, del.SubscriptionID, attempt, err)
+		}
+	}
+	// The outcome is recorded even when ctx was cancelled mid-way.
+	if err := d.store.RecordWebhookAttempt(context.WithoutCancel(ctx), del.ID, a); err != nil {
+		log.Printf("webhook record warn: %v", err)
+	}
+}
+
+// maskPayload returns payload with its order masked for role. An order that
+// cannot be masked is left out rather than sent as is.
+func maskPayload(payload []byte, role pii.Role) []byte {
+	if role == pii.RolePrivileged {
+		return payload
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return payload
+	}
+	order, ok := doc["order"]
+	if !ok || string(order) == "null" {
+		return payload
+	}
+	masked, err := view.Render(order, nil, role)
+	if err != nil {
+		log.Printf("webhook mask order warn: %v", err)
+		delete(doc, "order")
+	} else {
+		doc["order"] = masked
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return payload
+	}
+	return out
+}
+
+func (d *Dispatcher) backoff(failures int) time.Duration {
+	b := d.cfg.InitialBackoff
+	for i := 1; i < failures; i++ {
+		b *= 2
+		if d.cfg.MaxBackoff > 0 && b >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+	return b
+}
+
+// Send POSTs body signed with secret to url and returns the response status.
+// Anything but a 2xx answer is an error.
+func (d *Dispatcher) Send(ctx context.Context, url, secret, event, deliveryID string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the X-Webhook-Signature value of body sent at ts: the hex
+// HMAC-SHA256 of "<ts>.<body>" keyed with secret, prefixed with "sha256=".
+// Including the timestamp lets receivers reject replayed callbacks.
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a callback the way a receiver should: the signature must
+// match and the timestamp must be within tolerance of now.
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration, now time.Time) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body)))
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kosovrzn/wb-tech-l0/internal/mocks"
+	"github.com/kosovrzn/wb-tech-l0/internal/pii"
+	"github.com/kosovrzn/wb-tech-l0/internal/repo"
+)
+
+func TestDispatch_SignsAndRecordsDelivery(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	payload := []byte(`{"event":"order.persisted","order_uid":"A"}`)
+	var recorded repo.WebhookAttempt
+	store := &mocks.WebhookStoreMock{
+		ClaimWebhookDeliveriesFunc: func(ctx context.Context, limit int, lease time.Duration) ([]repo.WebhookDelivery, error) {
+			return []repo.WebhookDelivery{{ID: 7, SubscriptionID: 1, URL: srv.URL, Secret: "s3cret", OrderUID: "A", Event: repo.EventOrderPersisted, Payload: payload}}, nil
+		},
+		RecordWebhookAttemptFunc: func(ctx context.Context, id int64, a repo.WebhookAttempt) error {
+			recorded = a
+			return nil
+		},
+	}
+
+	d := NewDispatcher(store, srv.Client(), DefaultConfig())
+	if n, err := d.dispatch(context.Background()); err != nil || n != 1 {
+		t.Fatalf("dispatch = %d, %v", n, err)
+	}
+
+	if got == nil {
+		t.Fatal("callback not received")
+	}
+	if got.Header.Get(HeaderEvent) != repo.EventOrderPersisted || got.Header.Get(HeaderDelivery) != "7" {
+		t.Fatalf("unexpected headers: %v", got.Header)
+	}
+	if !Verify("s3cret", got.Header.Get(HeaderSignature), got.Header.Get(HeaderTimestamp), body, time.Minute, time.Now()) {
+		t.Fatal("signature does not verify")
+	}
+	if Verify("other", got.Header.Get(HeaderSignature), got.Header.Get(HeaderTimestamp), body, time.Minute, time.Now()) {
+		t.Fatal("signature verifies with a wrong secret")
+	}
+	if !recorded.Delivered || recorded.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected attempt: %+v", recorded)
+	}
+}
+
+func TestDispatch_RetriesWithBackoffThenGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	attempts := 0
+	var recorded []repo.WebhookAttempt
+	store := &mocks.WebhookStoreMock{
+		ClaimWebhookDeliveriesFunc: func(ctx context.Context, limit int, lease time.Duration) ([]repo.WebhookDelivery, error) {
+			return []repo.WebhookDelivery{{ID: 1, URL: srv.URL, Secret: "s", Attempts: attempts, Payload: []byte(`{}`)}}, nil
+		},
+		RecordWebhookAttemptFunc: func(ctx context.Context, id int64, a repo.WebhookAttempt) error {
+			recorded = append(recorded, a)
+			attempts++
+			return nil
+		},
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultConfig()
+	cfg.MaxAttempts = 3
+	cfg.InitialBackoff = time.Second
+	d := NewDispatcher(store, srv.Client(), cfg)
+	d.now = func() time.Time { return now }
+	for range cfg.MaxAttempts {
+		if _, err := d.dispatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []time.Time{now.Add(time.Second), now.Add(2 * time.Second), {}}
+	for i, a := range recorded {
+		if a.Delivered || a.StatusCode != http.StatusBadGateway || a.Err == "" {
+			t.Fatalf("attempt %d: unexpected %+v", i+1, a)
+		}
+		if !a.RetryAt.Equal(want[i]) {
+			t.Fatalf("attempt %d: retry at %v, want %v", i+1, a.RetryAt, want[i])
+		}
+	}
+}
+
+func TestDispatch_MasksOrderForSubscriptionRole(t *testing.T) {
+	bodies := make(chan string, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- r.Header.Get(HeaderDelivery) + " " + string(b)
+	}))
+	defer srv.Close()
+
+	payload := []byte(`{"event":"order.persisted","order_uid":"A","order":{"order_uid":"A","delivery":{"phone":"+9720000000"}}}`)
+	store := &mocks.WebhookStoreMock{
+		ClaimWebhookDeliveriesFunc: func(ctx context.Context, limit int, lease time.Duration) ([]repo.WebhookDelivery, error) {
+			var out []repo.WebhookDelivery
+			for i, role := range pii.Roles() {
+				out = append(out, repo.WebhookDelivery{ID: int64(i + 1), URL: srv.URL, Secret: "s", Role: role, Payload: payload})
+			}
+			return out, nil
+		},
+		RecordWebhookAttemptFunc: func(ctx context.Context, id int64, a repo.WebhookAttempt) error { return nil },
+	}
+	if _, err := NewDispatcher(store, srv.Client(), DefaultConfig()).dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(bodies)
+
+	want := map[string]string{"1": `"phone":"+9720000000"`, "2": `"phone":"+97*****000"`, "3": `"phone":"***"`}
+	for b := range bodies {
+		id, body, _ := strings.Cut(b, " ")
+		if !strings.Contains(body, want[id]) {
+			t.Errorf("delivery %s: expected %s in %s", id, want[id], body)
+		}
+	}
+}
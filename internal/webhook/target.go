@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned for callback URLs pointing into the
+// service's own network.
+var ErrForbiddenTarget = errors.New("webhook target not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, internal
+// like the private ranges netip does not count it in.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// forbiddenAddr reports whether callbacks must not reach a: loopback,
+// private, link-local, multicast and unspecified addresses.
+func forbiddenAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsLoopback() || a.IsPrivate() || a.IsLinkLocalUnicast() || a.IsLinkLocalMulticast() ||
+		a.IsInterfaceLocalMulticast() || a.IsMulticast() || a.IsUnspecified() || sharedAddressSpace.Contains(a)
+}
+
+// ValidateTarget checks a callback URL when a subscription is created: it
+// must be an absolute http(s) URL whose host is not localhost or a forbidden
+// address literal. Names resolving to forbidden addresses are refused when
+// connecting, see NewClient.
+func ValidateTarget(raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return errors.New("url must be an absolute http(s) URL without credentials")
+	}
+	if allowPrivate {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+	}
+	if a, err := netip.ParseAddr(host); err == nil && forbiddenAddr(a) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+	}
+	return nil
+}
+
+// NewClient returns the client callbacks are sent with. Unless allowPrivate,
+// it refuses to connect to forbidden addresses whatever the host resolves to,
+// which also covers redirects and DNS records changed after validation.
+// Redirects are not followed: a 3xx answer is a failed delivery.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if forbiddenAddr(ap.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenTarget, ap.Addr())
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Through a proxy the dialer would only see the proxy's address.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
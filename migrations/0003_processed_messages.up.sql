@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS processed_messages (
+    topic        text        NOT NULL,
+    partition    int         NOT NULL,
+    "offset"     bigint      NOT NULL,
+    order_uid    text        NOT NULL,
+    processed_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (topic, partition, "offset")
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_processed_messages_processed_at;
+DROP TABLE IF EXISTS processed_messages;
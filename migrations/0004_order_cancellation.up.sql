@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancelled_at timestamptz;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancel_reason text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE orders DROP COLUMN IF EXISTS cancel_reason;
+ALTER TABLE orders DROP COLUMN IF EXISTS cancelled_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS order_deletions (
+    id          bigserial   PRIMARY KEY,
+    order_uid   text        NOT NULL,
+    existed     boolean     NOT NULL,
+    topic       text,
+    partition   int,
+    "offset"    bigint,
+    deleted_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_deletions_order_uid ON order_deletions(order_uid);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_order_deletions_order_uid;
+DROP TABLE IF EXISTS order_deletions;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS schema_version int NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS orders_schema_version_idx ON orders (schema_version);
+
+-- +goose Down
+DROP INDEX IF EXISTS orders_schema_version_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS schema_version;
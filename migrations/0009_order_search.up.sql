@@ -0,0 +1,19 @@
+-- +goose Up
+-- Keyset pagination of GET /orders walks (date_created, order_uid) backwards;
+-- the composite index supersedes the one on date_created alone.
+CREATE INDEX IF NOT EXISTS idx_orders_date_created_order_uid ON orders(date_created DESC, order_uid DESC);
+DROP INDEX IF EXISTS idx_orders_date_created;
+
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id, date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders(track_number);
+CREATE INDEX IF NOT EXISTS idx_items_brand ON items(brand);
+CREATE INDEX IF NOT EXISTS idx_items_nm_id ON items(nm_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_items_nm_id;
+DROP INDEX IF EXISTS idx_items_brand;
+DROP INDEX IF EXISTS idx_orders_track_number;
+DROP INDEX IF EXISTS idx_orders_customer_id;
+
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created);
+DROP INDEX IF EXISTS idx_orders_date_created_order_uid;
@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_payments_transaction ON payments(transaction);
+CREATE INDEX IF NOT EXISTS idx_items_rid ON items(rid);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_items_rid;
+DROP INDEX IF EXISTS idx_payments_transaction;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Existing subscriptions keep receiving full orders; new ones are masked for
+-- support unless created with another role.
+ALTER TABLE webhook_subscriptions
+    ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'privileged'
+    CHECK (role IN ('privileged', 'support', 'analytics'));
+ALTER TABLE webhook_subscriptions ALTER COLUMN role SET DEFAULT 'support';
+
+-- +goose Down
+ALTER TABLE webhook_subscriptions DROP COLUMN IF EXISTS role;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS api_keys (
+    id         bigserial   PRIMARY KEY,
+    name       text        NOT NULL,
+    key_hash   text        NOT NULL UNIQUE,
+    scopes     text[]      NOT NULL DEFAULT '{}',
+    active     boolean     NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;